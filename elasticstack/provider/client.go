@@ -0,0 +1,131 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/elastic/go-elasticsearch/v7"
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+
+	"github.com/go-resty/resty/v2"
+
+	"github.com/hashicorp/go-version"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+type apiClient struct {
+	es     *elasticsearch.Client
+	esConn connectionConfig
+
+	// clients of the `elasticsearch_connection` blocks and versions of all the clusters,
+	// shared by the resources using the same connection
+	esMu       sync.Mutex
+	esClients  map[string]*elasticsearch.Client
+	esVersions map[*elasticsearch.Client]*version.Version
+
+	kibanaURL       string
+	newKibanaClient func() (*resty.Client, error)
+
+	kibanaMu     sync.Mutex
+	kibanaClient *resty.Client
+
+	kbVersionMu sync.Mutex
+	kbVersion   *version.Version
+}
+
+// resourceData is implemented by both schema.ResourceData and schema.ResourceDiff.
+type resourceData interface {
+	GetOk(string) (interface{}, bool)
+}
+
+// elasticsearch returns the Elasticsearch client of a resource, which is a dedicated one
+// when the resource sets an `elasticsearch_connection` block. Dedicated clients are created
+// once per distinct connection.
+func (c *apiClient) elasticsearch(d resourceData) (*elasticsearch.Client, error) {
+	v, ok := d.GetOk("elasticsearch_connection")
+	if !ok || len(v.([]interface{})) == 0 || v.([]interface{})[0] == nil {
+		if c.es == nil {
+			return nil, fmt.Errorf("Elasticsearch client is not configured")
+		}
+		return c.es, nil
+	}
+
+	conn := expandConnectionConfig(d, "elasticsearch_connection", c.esConn)
+	key := fmt.Sprintf("%#v", conn)
+
+	c.esMu.Lock()
+	defer c.esMu.Unlock()
+
+	if es, ok := c.esClients[key]; ok {
+		return es, nil
+	}
+	es, err := newElasticsearchClient(conn)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create Elasticsearch client for 'elasticsearch_connection': %w", err)
+	}
+	if c.esClients == nil {
+		c.esClients = map[string]*elasticsearch.Client{}
+	}
+	c.esClients[key] = es
+	return es, nil
+}
+
+// performRequest sends a request without body to an Elasticsearch API that esapi does not
+// provide, returning the response in the same form as esapi requests.
+func performRequest(ctx context.Context, es *elasticsearch.Client, method string, path string) (*esapi.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := es.Perform(req)
+	if err != nil {
+		return nil, err
+	}
+
+	return &esapi.Response{
+		StatusCode: res.StatusCode,
+		Body:       res.Body,
+		Header:     res.Header,
+	}, nil
+}
+
+func (c *apiClient) hasKibana() bool {
+	return c.kibanaURL != ""
+}
+
+// kibana returns the Kibana client, creating it and checking that Kibana is reachable
+// the first time it is used. Failures are not cached, so that a later call can succeed.
+func (c *apiClient) kibana(ctx context.Context) (*resty.Client, error) {
+	c.kibanaMu.Lock()
+	defer c.kibanaMu.Unlock()
+
+	if c.kibanaClient != nil {
+		return c.kibanaClient, nil
+	}
+	if !c.hasKibana() {
+		return nil, fmt.Errorf("Kibana is not configured, set 'kibana_url' or 'cloud_id' in the provider configuration")
+	}
+
+	k, err := c.newKibanaClient()
+	if err != nil {
+		return nil, fmt.Errorf("unable to create Kibana client: %w", err)
+	}
+	if _, err := k.R().SetContext(ctx).Get("/"); err != nil {
+		return nil, fmt.Errorf("unable to connect to Kibana: %w", err)
+	}
+	c.kibanaClient = k
+	return k, nil
+}
+
+// requireKibana fails the plan of resources managed through Kibana when the provider
+// has no Kibana endpoint configured.
+func requireKibana(ctx context.Context, d *schema.ResourceDiff, meta interface{}) error {
+	if !meta.(*apiClient).hasKibana() {
+		return fmt.Errorf("this resource is managed through Kibana, set 'kibana_url' or 'cloud_id' in the provider configuration")
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/elastic/go-elasticsearch/v7"
+
+	"github.com/go-resty/resty/v2"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func TestKibanaDoesNotCacheFailures(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	attempts := 0
+	client := &apiClient{
+		kibanaURL: server.URL,
+		newKibanaClient: func() (*resty.Client, error) {
+			attempts++
+			if attempts == 1 {
+				return nil, fmt.Errorf("transient failure")
+			}
+			return resty.New().SetHostURL(server.URL), nil
+		},
+	}
+
+	if _, err := client.kibana(context.Background()); err == nil {
+		t.Fatal("expected the first call to fail")
+	}
+	k, err := client.kibana(context.Background())
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if again, _ := client.kibana(context.Background()); again != k || attempts != 2 {
+		t.Fatalf("expected the Kibana client to be cached once created, got %d attempts", attempts)
+	}
+}
+
+func TestElasticsearchClientsAreCachedPerConnection(t *testing.T) {
+	infoRequests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		infoRequests++
+		fmt.Fprint(w, `{"version": {"number": "7.13.0"}}`)
+	}))
+	defer server.Close()
+
+	client := &apiClient{
+		esConn: connectionConfig{apiKey: "key"},
+	}
+	resourceWithURL := func(url string) *schema.ResourceData {
+		return schema.TestResourceDataRaw(t, resourceElasticstackAuthRole().Schema, map[string]interface{}{
+			"name": "role",
+			"elasticsearch_connection": []interface{}{
+				map[string]interface{}{
+					"urls": []interface{}{url},
+				},
+			},
+		})
+	}
+
+	es1, err := client.elasticsearch(resourceWithURL(server.URL))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	es2, err := client.elasticsearch(resourceWithURL(server.URL))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if es1 != es2 {
+		t.Fatal("expected resources using the same connection to share a client")
+	}
+	if es3, _ := client.elasticsearch(resourceWithURL("http://other:9200")); es3 == es1 {
+		t.Fatal("expected resources using different connections to use different clients")
+	}
+
+	for i := 0; i < 2; i++ {
+		v, err := client.elasticsearchVersion(context.Background(), resourceWithURL(server.URL))
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if v.String() != "7.13.0" {
+			t.Fatalf("unexpected version: %s", v)
+		}
+	}
+	if infoRequests != 1 {
+		t.Fatalf("expected the version to be fetched once, got %d requests", infoRequests)
+	}
+}
+
+func TestKibanaVersionDoesNotCacheFailures(t *testing.T) {
+	statusRequests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/status" {
+			return
+		}
+		statusRequests++
+		if statusRequests == 1 {
+			w.WriteHeader(503)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"version": {"number": "7.13.0"}}`)
+	}))
+	defer server.Close()
+
+	client := &apiClient{
+		kibanaURL: server.URL,
+		newKibanaClient: func() (*resty.Client, error) {
+			return resty.New().SetHostURL(server.URL), nil
+		},
+	}
+
+	if _, err := client.kibanaVersion(context.Background()); err == nil {
+		t.Fatal("expected the first call to fail")
+	}
+	for i := 0; i < 2; i++ {
+		v, err := client.kibanaVersion(context.Background())
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if v.String() != "7.13.0" {
+			t.Fatalf("unexpected version: %s", v)
+		}
+	}
+	if statusRequests != 2 {
+		t.Fatalf("expected the version to be cached once fetched, got %d requests", statusRequests)
+	}
+}
+
+// testElasticsearchClient returns a client talking to a test server, closed with the test.
+func testElasticsearchClient(t *testing.T, handler http.HandlerFunc) *elasticsearch.Client {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	es, err := newElasticsearchClient(connectionConfig{urls: []string{server.URL}, apiKey: "key"})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	return es
+}
@@ -0,0 +1,286 @@
+package provider
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/elastic/go-elasticsearch/v7"
+
+	"github.com/go-resty/resty/v2"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// connectionConfig holds everything needed to build a client for a single service.
+type connectionConfig struct {
+	urls []string
+
+	username    string
+	password    string
+	apiKey      string
+	bearerToken string
+	headers     map[string]string
+
+	caFile   string
+	caData   string
+	certFile string
+	keyFile  string
+	insecure bool
+
+	sniff         bool
+	maxRetries    int
+	retryOnStatus []int
+}
+
+func (c connectionConfig) hasCredentials() bool {
+	return c.apiKey != "" || c.bearerToken != "" || (c.username != "" && c.password != "")
+}
+
+// connectionSchema returns the credentials, TLS and header attributes shared by the
+// connection blocks. The prefix is the path of the block, used for attribute conflicts.
+func connectionSchema(prefix string) map[string]*schema.Schema {
+	return map[string]*schema.Schema{
+		"username": {
+			Description:   "Username to use for API authentication.",
+			Type:          schema.TypeString,
+			Optional:      true,
+			RequiredWith:  []string{prefix + "password"},
+			ConflictsWith: []string{prefix + "api_key", prefix + "bearer_token"},
+		},
+		"password": {
+			Description:   "Password to use for API authentication.",
+			Type:          schema.TypeString,
+			Optional:      true,
+			Sensitive:     true,
+			RequiredWith:  []string{prefix + "username"},
+			ConflictsWith: []string{prefix + "api_key", prefix + "bearer_token"},
+		},
+		"api_key": {
+			Description:   "Base64 encoded API key to use for API authentication.",
+			Type:          schema.TypeString,
+			Optional:      true,
+			Sensitive:     true,
+			ConflictsWith: []string{prefix + "username", prefix + "password", prefix + "bearer_token"},
+		},
+		"bearer_token": {
+			Description:   "Bearer token, such as a service account token, to use for API authentication.",
+			Type:          schema.TypeString,
+			Optional:      true,
+			Sensitive:     true,
+			ConflictsWith: []string{prefix + "username", prefix + "password", prefix + "api_key"},
+		},
+		"headers": {
+			Description: "Additional HTTP headers sent with every request.",
+			Type:        schema.TypeMap,
+			Optional:    true,
+			Sensitive:   true,
+			Elem: &schema.Schema{
+				Type: schema.TypeString,
+			},
+		},
+		"ca_file": {
+			Description:   "Path to a PEM-encoded custom Certificate Authority certificate.",
+			Type:          schema.TypeString,
+			Optional:      true,
+			ConflictsWith: []string{prefix + "ca_data"},
+		},
+		"ca_data": {
+			Description:   "PEM-encoded custom Certificate Authority certificate.",
+			Type:          schema.TypeString,
+			Optional:      true,
+			ConflictsWith: []string{prefix + "ca_file"},
+		},
+		"cert_file": {
+			Description:  "Path to a PEM-encoded client certificate used for mutual TLS.",
+			Type:         schema.TypeString,
+			Optional:     true,
+			RequiredWith: []string{prefix + "key_file"},
+		},
+		"key_file": {
+			Description:  "Path to the PEM-encoded private key of the client certificate.",
+			Type:         schema.TypeString,
+			Optional:     true,
+			RequiredWith: []string{prefix + "cert_file"},
+		},
+		"insecure": {
+			Description:  "Disable TLS certificate verification, `true` or `false`. Setting it to `false` restores verification disabled by the top-level attribute.",
+			Type:         schema.TypeString,
+			Optional:     true,
+			ValidateFunc: validateOptionalBool,
+		},
+	}
+}
+
+// elasticsearchConnectionResourceSchema returns the `elasticsearch_connection` block that
+// lets a single resource target a different cluster than the one of the provider. Changing
+// the URLs replaces the resource, since an update would only apply to the new cluster and
+// leave the object behind on the previous one. Credentials, TLS settings and headers can be
+// changed in place.
+func elasticsearchConnectionResourceSchema() *schema.Schema {
+	s := elasticsearchConnectionSchema("elasticsearch_connection.0.")
+	s["urls"].ForceNew = true
+
+	return &schema.Schema{
+		Description: "Elasticsearch connection used by this resource instead of the provider one. Unset attributes are inherited from the provider configuration. Changing the URLs replaces the resource.",
+		Type:        schema.TypeList,
+		Optional:    true,
+		MaxItems:    1,
+		Elem: &schema.Resource{
+			Schema: s,
+		},
+	}
+}
+
+// expandConnectionConfig overrides the base configuration with the values set in the
+// connection block stored under key. Credentials are replaced as a whole, so that a block
+// using an API key does not inherit the username and password of the base configuration.
+func expandConnectionConfig(d resourceData, key string, base connectionConfig) connectionConfig {
+	v, ok := d.GetOk(key)
+	if !ok || len(v.([]interface{})) == 0 || v.([]interface{})[0] == nil {
+		return base
+	}
+	block := v.([]interface{})[0].(map[string]interface{})
+	conn := base
+
+	if urls, ok := block["urls"].([]interface{}); ok && len(urls) > 0 {
+		conn.urls = expandStringList(urls)
+	}
+	if url, ok := block["url"].(string); ok && url != "" {
+		conn.urls = []string{url}
+	}
+
+	username, _ := block["username"].(string)
+	password, _ := block["password"].(string)
+	apiKey, _ := block["api_key"].(string)
+	bearerToken, _ := block["bearer_token"].(string)
+	if username != "" || password != "" || apiKey != "" || bearerToken != "" {
+		conn.username = username
+		conn.password = password
+		conn.apiKey = apiKey
+		conn.bearerToken = bearerToken
+	}
+
+	if headers, ok := block["headers"].(map[string]interface{}); ok && len(headers) > 0 {
+		conn.headers = map[string]string{}
+		for k, v := range headers {
+			conn.headers[k] = v.(string)
+		}
+	}
+
+	caFile, _ := block["ca_file"].(string)
+	caData, _ := block["ca_data"].(string)
+	if caFile != "" || caData != "" {
+		conn.caFile = caFile
+		conn.caData = caData
+	}
+	if certFile, _ := block["cert_file"].(string); certFile != "" {
+		conn.certFile = certFile
+		conn.keyFile, _ = block["key_file"].(string)
+	}
+	// a string, so that an explicit false can be told apart from an unset attribute
+	if insecure, _ := block["insecure"].(string); insecure != "" {
+		conn.insecure = insecure == "true"
+	}
+
+	return conn
+}
+
+// validateOptionalBool accepts "true", "false" or an empty string for an unset value.
+func validateOptionalBool(i interface{}, k string) ([]string, []error) {
+	v, ok := i.(string)
+	if !ok {
+		return nil, []error{fmt.Errorf("expected type of %s to be string", k)}
+	}
+	if v != "" && v != "true" && v != "false" {
+		return nil, []error{fmt.Errorf("%q must be either 'true' or 'false', got '%s'", k, v)}
+	}
+	return nil, nil
+}
+
+func newTLSConfig(conn connectionConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: conn.insecure,
+	}
+
+	caData := []byte(conn.caData)
+	if conn.caFile != "" {
+		data, err := ioutil.ReadFile(conn.caFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read CA file: %w", err)
+		}
+		caData = data
+	}
+	if len(caData) > 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caData) {
+			return nil, fmt.Errorf("unable to parse CA certificate")
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if conn.certFile != "" {
+		cert, err := tls.LoadX509KeyPair(conn.certFile, conn.keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+func newElasticsearchClient(conn connectionConfig) (*elasticsearch.Client, error) {
+	tlsConfig, err := newTLSConfig(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+
+	header := http.Header{}
+	for k, v := range conn.headers {
+		header.Set(k, v)
+	}
+	if conn.bearerToken != "" {
+		header.Set("Authorization", "Bearer "+conn.bearerToken)
+	}
+
+	return elasticsearch.NewClient(elasticsearch.Config{
+		Addresses:            conn.urls,
+		Username:             conn.username,
+		Password:             conn.password,
+		APIKey:               conn.apiKey,
+		Header:               header,
+		Transport:            transport,
+		DiscoverNodesOnStart: conn.sniff,
+		MaxRetries:           conn.maxRetries,
+		DisableRetry:         conn.maxRetries == 0,
+		RetryOnStatus:        conn.retryOnStatus,
+	})
+}
+
+func newKibanaClient(conn connectionConfig) (*resty.Client, error) {
+	tlsConfig, err := newTLSConfig(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	k := resty.New().
+		SetHeader("kbn-xsrf", "true").
+		SetHeaders(conn.headers).
+		SetHostURL(conn.urls[0]).
+		SetTLSClientConfig(tlsConfig)
+	switch {
+	case conn.bearerToken != "":
+		k.SetAuthScheme("Bearer").SetAuthToken(conn.bearerToken)
+	case conn.apiKey != "":
+		k.SetAuthScheme("ApiKey").SetAuthToken(conn.apiKey)
+	case conn.username != "":
+		k.SetBasicAuth(conn.username, conn.password)
+	}
+	return k, nil
+}
@@ -0,0 +1,99 @@
+package provider
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+)
+
+type esapiErrorCause struct {
+	Type      string            `json:"type"`
+	Reason    string            `json:"reason"`
+	RootCause []esapiErrorCause `json:"root_cause"`
+	CausedBy  *esapiErrorCause  `json:"caused_by"`
+}
+
+func (c esapiErrorCause) String() string {
+	if c.Type == "" {
+		return c.Reason
+	}
+	return fmt.Sprintf("[%s] %s", c.Type, c.Reason)
+}
+
+// elasticsearchError turns an Elasticsearch error response into a diagnostic, decoding the
+// error envelope when the response has one.
+func elasticsearchError(res *esapi.Response, summary string) diag.Diagnostics {
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return diag.Diagnostics{{
+			Severity: diag.Error,
+			Summary:  fmt.Sprintf("%s: %s", summary, http.StatusText(res.StatusCode)),
+			Detail:   fmt.Sprintf("HTTP status %d, unable to read response body: %s", res.StatusCode, err),
+		}}
+	}
+	return diag.Diagnostics{parseElasticsearchError(res.StatusCode, body, summary)}
+}
+
+func parseElasticsearchError(status int, body []byte, summary string) diag.Diagnostic {
+	d := diag.Diagnostic{
+		Severity: diag.Error,
+		Summary:  fmt.Sprintf("%s: %s", summary, http.StatusText(status)),
+	}
+
+	var envelope struct {
+		Error json.RawMessage `json:"error"`
+	}
+	if err := json.Unmarshal(body, &envelope); err != nil || len(envelope.Error) == 0 {
+		d.Detail = fmt.Sprintf("HTTP status %d: %s", status, strings.TrimSpace(string(body)))
+		return d
+	}
+
+	var cause esapiErrorCause
+	if err := json.Unmarshal(envelope.Error, &cause); err != nil {
+		// some APIs return the error as a plain string
+		if err := json.Unmarshal(envelope.Error, &cause.Reason); err != nil {
+			d.Detail = fmt.Sprintf("HTTP status %d: %s", status, strings.TrimSpace(string(body)))
+			return d
+		}
+	}
+
+	d.Summary = fmt.Sprintf("%s: %s", summary, cause)
+
+	details := []string{fmt.Sprintf("HTTP status %d", status)}
+	for _, r := range cause.RootCause {
+		details = append(details, fmt.Sprintf("Root cause: %s", r))
+	}
+	for c := cause.CausedBy; c != nil; c = c.CausedBy {
+		details = append(details, fmt.Sprintf("Caused by: %s", c))
+	}
+	d.Detail = strings.Join(details, "\n")
+
+	return d
+}
+
+// diagnosticsError converts error diagnostics into an error, for functions that can only
+// return an error.
+func diagnosticsError(diags diag.Diagnostics) error {
+	var msgs []string
+	for _, d := range diags {
+		if d.Severity != diag.Error {
+			continue
+		}
+		msg := d.Summary
+		if d.Detail != "" {
+			msg = fmt.Sprintf("%s\n\n%s", msg, d.Detail)
+		}
+		msgs = append(msgs, msg)
+	}
+	if len(msgs) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(msgs, "\n\n"))
+}
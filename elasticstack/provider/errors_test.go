@@ -0,0 +1,38 @@
+package provider
+
+import (
+	"testing"
+)
+
+func TestParseElasticsearchError(t *testing.T) {
+	body := `{
+		"error": {
+			"root_cause": [{"type": "illegal_argument_exception", "reason": "unknown cluster privilege [foo]"}],
+			"type": "illegal_argument_exception",
+			"reason": "unknown cluster privilege [foo]",
+			"caused_by": {"type": "parse_exception", "reason": "failed to parse"}
+		},
+		"status": 400
+	}`
+
+	d := parseElasticsearchError(400, []byte(body), "Unable to create role")
+	if d.Summary != "Unable to create role: [illegal_argument_exception] unknown cluster privilege [foo]" {
+		t.Fatalf("unexpected summary: %s", d.Summary)
+	}
+	expectedDetail := "HTTP status 400\n" +
+		"Root cause: [illegal_argument_exception] unknown cluster privilege [foo]\n" +
+		"Caused by: [parse_exception] failed to parse"
+	if d.Detail != expectedDetail {
+		t.Fatalf("unexpected detail: %s", d.Detail)
+	}
+
+	d = parseElasticsearchError(500, []byte(`{"error": "something went wrong"}`), "Unable to get user")
+	if d.Summary != "Unable to get user: something went wrong" {
+		t.Fatalf("unexpected summary: %s", d.Summary)
+	}
+
+	d = parseElasticsearchError(502, []byte(`Bad Gateway`), "Unable to get user")
+	if d.Summary != "Unable to get user: Bad Gateway" || d.Detail != "HTTP status 502: Bad Gateway" {
+		t.Fatalf("unexpected diagnostic: %s / %s", d.Summary, d.Detail)
+	}
+}
@@ -0,0 +1,295 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// Kibana stores its privileges as privileges of the "kibana-.kibana" application, using
+// "space:<id>" resources. Base privileges are named "all" and "read" for all spaces and
+// "space_all" and "space_read" for specific spaces, feature privileges are named
+// "feature_<feature>.<privilege>" and reserved privileges "reserved_<name>".
+const kibanaApplication = "kibana-.kibana"
+
+var spacesRegex = regexp.MustCompile(`^space:(.+)$`)
+
+func kibanaPrivilegeSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:     schema.TypeList,
+		Optional: true,
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				"spaces": {
+					Type:     schema.TypeList,
+					Required: true,
+					MinItems: 1,
+					Elem: &schema.Schema{
+						Type: schema.TypeString,
+					},
+				},
+				"base": {
+					Type:        schema.TypeList,
+					Optional:    true,
+					Description: "Base privileges granted on all features, `all` or `read`. Cannot be used together with `feature`.",
+					Elem: &schema.Schema{
+						Type:         schema.TypeString,
+						ValidateFunc: validateKibanaBasePrivilege,
+					},
+				},
+				"feature": {
+					Type:        schema.TypeList,
+					Optional:    true,
+					Description: "Privileges granted on a single feature, such as `discover` or `dashboard`.",
+					Elem: &schema.Resource{
+						Schema: map[string]*schema.Schema{
+							"name": {
+								Type:     schema.TypeString,
+								Required: true,
+							},
+							"privileges": {
+								Type:     schema.TypeList,
+								Required: true,
+								MinItems: 1,
+								Elem: &schema.Schema{
+									Type: schema.TypeString,
+								},
+							},
+						},
+					},
+				},
+				"reserved": {
+					Type:        schema.TypeList,
+					Optional:    true,
+					Description: "Reserved privileges, such as `ml_user` or `monitoring`. Only valid for all spaces (`*`).",
+					Elem: &schema.Schema{
+						Type: schema.TypeString,
+					},
+				},
+				"privileges": {
+					Type:        schema.TypeList,
+					Optional:    true,
+					Description: "Raw application privileges, as stored in Elasticsearch.",
+					Deprecated:  "Use `base`, `feature` and `reserved` instead.",
+					Elem: &schema.Schema{
+						Type: schema.TypeString,
+					},
+				},
+			},
+		},
+	}
+}
+
+func validateKibanaBasePrivilege(i interface{}, k string) ([]string, []error) {
+	v, ok := i.(string)
+	if !ok {
+		return nil, []error{fmt.Errorf("expected type of %s to be string", k)}
+	}
+	if v != "all" && v != "read" {
+		return nil, []error{fmt.Errorf("%q must be either 'all' or 'read', got '%s'", k, v)}
+	}
+	return nil, nil
+}
+
+func isAllSpaces(spaces []string) bool {
+	return len(spaces) == 1 && spaces[0] == "*"
+}
+
+func expandKibanaPrivilege(privilege map[string]interface{}) (esapiRoleDataApplication, error) {
+	spaces := expandStringList(privilege["spaces"].([]interface{}))
+	base := expandStringList(privilege["base"].([]interface{}))
+	features := privilege["feature"].([]interface{})
+	reserved := expandStringList(privilege["reserved"].([]interface{}))
+
+	if len(base) > 0 && len(features) > 0 {
+		return esapiRoleDataApplication{}, fmt.Errorf("'base' and 'feature' cannot be used in the same kibana_privilege")
+	}
+	if len(reserved) > 0 && !isAllSpaces(spaces) {
+		return esapiRoleDataApplication{}, fmt.Errorf("'reserved' privileges can only be granted on all spaces (\"*\")")
+	}
+
+	application := esapiRoleDataApplication{
+		Application: kibanaApplication,
+		Privileges:  expandStringList(privilege["privileges"].([]interface{})),
+		Resources:   []string{},
+	}
+	for _, b := range base {
+		if !isAllSpaces(spaces) {
+			b = "space_" + b
+		}
+		application.Privileges = append(application.Privileges, b)
+	}
+	for _, f := range features {
+		feature := f.(map[string]interface{})
+		for _, p := range expandStringList(feature["privileges"].([]interface{})) {
+			application.Privileges = append(application.Privileges, fmt.Sprintf("feature_%s.%s", feature["name"].(string), p))
+		}
+	}
+	for _, r := range reserved {
+		application.Privileges = append(application.Privileges, "reserved_"+r)
+	}
+	for _, v := range spaces {
+		if v != "*" {
+			v = fmt.Sprintf("space:%s", v)
+		}
+		application.Resources = append(application.Resources, v)
+	}
+	return application, nil
+}
+
+// flattenKibanaPrivilege converts an application privilege into a `kibana_privilege` block,
+// returning false if it is not a privilege of Kibana. When raw is set, the privileges are kept
+// in the deprecated `privileges` attribute.
+func flattenKibanaPrivilege(a esapiRoleDataApplication, raw bool) (map[string]interface{}, bool) {
+	spaces, ok := kibanaSpaces(a)
+	if !ok {
+		return nil, false
+	}
+
+	privilege := map[string]interface{}{
+		"spaces": collapseStringList(spaces),
+	}
+	if raw {
+		privilege["privileges"] = collapseStringList(a.Privileges)
+		return privilege, true
+	}
+
+	var base, reserved []string
+	features := []interface{}{}
+	featureIndex := map[string]map[string]interface{}{}
+	for _, p := range a.Privileges {
+		switch {
+		case strings.HasPrefix(p, "feature_"):
+			parts := strings.SplitN(strings.TrimPrefix(p, "feature_"), ".", 2)
+			if len(parts) != 2 {
+				base = append(base, p)
+				continue
+			}
+			feature, ok := featureIndex[parts[0]]
+			if !ok {
+				feature = map[string]interface{}{
+					"name":       parts[0],
+					"privileges": []interface{}{},
+				}
+				featureIndex[parts[0]] = feature
+				features = append(features, feature)
+			}
+			feature["privileges"] = append(feature["privileges"].([]interface{}), parts[1])
+		case strings.HasPrefix(p, "reserved_"):
+			reserved = append(reserved, strings.TrimPrefix(p, "reserved_"))
+		default:
+			base = append(base, strings.TrimPrefix(p, "space_"))
+		}
+	}
+
+	privilege["base"] = collapseStringList(base)
+	privilege["feature"] = features
+	privilege["reserved"] = collapseStringList(reserved)
+	return privilege, true
+}
+
+// kibanaSpaces returns the Kibana spaces of an application privilege, or false if the
+// privilege is not one of Kibana that can be expressed as a `kibana_privilege` block.
+func kibanaSpaces(a esapiRoleDataApplication) ([]string, bool) {
+	if a.Application != kibanaApplication {
+		return nil, false
+	}
+	spaces := []string{}
+	for _, r := range a.Resources {
+		if spacesMatches := spacesRegex.FindStringSubmatch(r); spacesMatches != nil {
+			spaces = append(spaces, spacesMatches[1])
+			continue
+		}
+		if r == "*" {
+			spaces = append(spaces, r)
+			continue
+		}
+		return nil, false
+	}
+	return spaces, true
+}
+
+type KibanaFeature struct {
+	Id          string `json:"id"`
+	SubFeatures []struct {
+		PrivilegeGroups []struct {
+			Privileges []struct {
+				Id string `json:"id"`
+			} `json:"privileges"`
+		} `json:"privilegeGroups"`
+	} `json:"subFeatures"`
+}
+
+// validateKibanaFeatures checks the feature privileges of a role against the features
+// known to Kibana. The check is skipped when Kibana is not configured.
+func validateKibanaFeatures(ctx context.Context, d *schema.ResourceDiff, meta interface{}) error {
+	client := meta.(*apiClient)
+	if !client.hasKibana() || !d.HasChange("kibana_privilege") {
+		return nil
+	}
+
+	type featurePrivilege struct{ feature, privilege string }
+	var configured []featurePrivilege
+	for _, p := range d.Get("kibana_privilege").([]interface{}) {
+		privilege, ok := p.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for _, f := range privilege["feature"].([]interface{}) {
+			feature, ok := f.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			for _, priv := range expandStringList(feature["privileges"].([]interface{})) {
+				configured = append(configured, featurePrivilege{feature["name"].(string), priv})
+			}
+		}
+	}
+	if len(configured) == 0 {
+		return nil
+	}
+
+	k, err := client.kibana(ctx)
+	if err != nil {
+		return err
+	}
+
+	var features []KibanaFeature
+	resp, err := k.R().
+		SetContext(ctx).
+		SetResult(&features).
+		Get("/api/features")
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode() != 200 {
+		return fmt.Errorf("error in features get: %s", resp.Body())
+	}
+
+	known := map[string]map[string]bool{}
+	for _, f := range features {
+		privileges := map[string]bool{"all": true, "read": true, "minimal_all": true, "minimal_read": true}
+		for _, s := range f.SubFeatures {
+			for _, g := range s.PrivilegeGroups {
+				for _, p := range g.Privileges {
+					privileges[p.Id] = true
+				}
+			}
+		}
+		known[f.Id] = privileges
+	}
+
+	for _, c := range configured {
+		privileges, ok := known[c.feature]
+		if !ok {
+			return fmt.Errorf("Kibana has no feature named '%s'", c.feature)
+		}
+		if !privileges[c.privilege] {
+			return fmt.Errorf("Kibana feature '%s' has no privilege named '%s'", c.feature, c.privilege)
+		}
+	}
+	return nil
+}
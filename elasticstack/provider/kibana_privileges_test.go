@@ -0,0 +1,92 @@
+package provider
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestKibanaPrivilegeRoundTrip(t *testing.T) {
+	privilege := map[string]interface{}{
+		"spaces":     []interface{}{"marketing", "sales"},
+		"base":       []interface{}{},
+		"reserved":   []interface{}{},
+		"privileges": []interface{}{},
+		"feature": []interface{}{
+			map[string]interface{}{
+				"name":       "discover",
+				"privileges": []interface{}{"read"},
+			},
+			map[string]interface{}{
+				"name":       "dashboard",
+				"privileges": []interface{}{"all"},
+			},
+		},
+	}
+
+	application, err := expandKibanaPrivilege(privilege)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(application.Privileges, []string{"feature_discover.read", "feature_dashboard.all"}) {
+		t.Fatalf("unexpected privileges: %v", application.Privileges)
+	}
+	if !reflect.DeepEqual(application.Resources, []string{"space:marketing", "space:sales"}) {
+		t.Fatalf("unexpected resources: %v", application.Resources)
+	}
+
+	flattened, ok := flattenKibanaPrivilege(application, false)
+	if !ok {
+		t.Fatal("expected a Kibana privilege")
+	}
+	if !reflect.DeepEqual(flattened["feature"], privilege["feature"]) {
+		t.Fatalf("unexpected features: %v", flattened["feature"])
+	}
+	if !reflect.DeepEqual(flattened["spaces"], privilege["spaces"]) {
+		t.Fatalf("unexpected spaces: %v", flattened["spaces"])
+	}
+}
+
+func TestKibanaPrivilegeBaseAndReserved(t *testing.T) {
+	application, err := expandKibanaPrivilege(map[string]interface{}{
+		"spaces":     []interface{}{"marketing"},
+		"base":       []interface{}{"all"},
+		"feature":    []interface{}{},
+		"reserved":   []interface{}{},
+		"privileges": []interface{}{},
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(application.Privileges, []string{"space_all"}) {
+		t.Fatalf("unexpected privileges: %v", application.Privileges)
+	}
+
+	flattened, _ := flattenKibanaPrivilege(esapiRoleDataApplication{
+		Application: kibanaApplication,
+		Privileges:  []string{"all", "reserved_ml_user"},
+		Resources:   []string{"*"},
+	}, false)
+	if !reflect.DeepEqual(flattened["base"], []interface{}{"all"}) || !reflect.DeepEqual(flattened["reserved"], []interface{}{"ml_user"}) {
+		t.Fatalf("unexpected privilege: %v", flattened)
+	}
+
+	_, err = expandKibanaPrivilege(map[string]interface{}{
+		"spaces":     []interface{}{"marketing"},
+		"base":       []interface{}{},
+		"feature":    []interface{}{},
+		"reserved":   []interface{}{"ml_user"},
+		"privileges": []interface{}{},
+	})
+	if err == nil {
+		t.Fatal("expected an error for reserved privileges on a specific space")
+	}
+}
+
+func TestValidateCustomApplication(t *testing.T) {
+	if _, errs := validateCustomApplication("myapp", "application"); len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	if _, errs := validateCustomApplication(kibanaApplication, "application"); len(errs) == 0 {
+		t.Fatal("expected an error for the Kibana application")
+	}
+}
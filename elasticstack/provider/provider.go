@@ -2,8 +2,10 @@ package provider
 
 import (
 	"context"
-
-	"github.com/elastic/go-elasticsearch/v7"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
 
 	"github.com/go-resty/resty/v2"
 
@@ -30,39 +32,137 @@ func init() {
 func newSchema() map[string]*schema.Schema {
 	return map[string]*schema.Schema{
 		"elasticsearch_url": {
-			Description: "Elasticsearch URL to use for API Authentication.",
+			Description: "Elasticsearch URL to use for API Authentication. Required unless `elasticsearch_urls` or `cloud_id` is set, defaults to the `ELASTICSEARCH_URL` environment variable.",
 			Type:        schema.TypeString,
-			Required:    true,
-			DefaultFunc: schema.EnvDefaultFunc(
-				"ELASTICSEARCH_URL", "",
-			),
+			Optional:    true,
+		},
+		"elasticsearch_urls": {
+			Description: "List of Elasticsearch URLs to use for API Authentication, requests are balanced and retried across all of them. Cannot be used together with `elasticsearch_url`.",
+			Type:        schema.TypeList,
+			Optional:    true,
+			Elem: &schema.Schema{
+				Type: schema.TypeString,
+			},
+		},
+		"sniff": {
+			Description: "Discover the other nodes of the Elasticsearch cluster when the client is created.",
+			Type:        schema.TypeBool,
+			Optional:    true,
+			Default:     false,
+		},
+		"max_retries": {
+			Description: "Maximum number of retries of a failed Elasticsearch request, `0` disables retries.",
+			Type:        schema.TypeInt,
+			Optional:    true,
+			Default:     3,
+		},
+		"retry_on_status": {
+			Description: "HTTP status codes of Elasticsearch responses that are retried. Defaults to `[429, 502, 503, 504]`.",
+			Type:        schema.TypeList,
+			Optional:    true,
+			Elem: &schema.Schema{
+				Type: schema.TypeInt,
+			},
 		},
 		"kibana_url": {
-			Description: "Kibana URL to use for API Authentication.",
+			Description: "Kibana URL to use for API Authentication. Only required by resources managed through Kibana, such as `elasticstack_fleet_agent_policy`. Defaults to the `KIBANA_URL` environment variable.",
 			Type:        schema.TypeString,
-			Required:    true,
-			DefaultFunc: schema.EnvDefaultFunc(
-				"KIBANA_URL", "",
-			),
+			Optional:    true,
+		},
+		"cloud_id": {
+			Description: "Elastic Cloud ID of the deployment, used to derive `elasticsearch_url` and `kibana_url` when they are not set. Defaults to the `ELASTIC_CLOUD_ID` environment variable.",
+			Type:        schema.TypeString,
+			Optional:    true,
 		},
 		"username": {
-			Description: "Username to use for API authentication.",
+			Description: "Username to use for API authentication. Defaults to the `ELASTICSEARCH_USER` environment variable.",
 			Type:        schema.TypeString,
-			Required:    true,
-			DefaultFunc: schema.EnvDefaultFunc(
-				"ELASTICSEARCH_USER", "",
-			),
+			Optional:    true,
 		},
 		"password": {
-			Description: "Password to use for API authentication.",
+			Description: "Password to use for API authentication. Defaults to the `ELASTICSEARCH_PASSWORD` environment variable.",
+			Type:        schema.TypeString,
+			Optional:    true,
+			Sensitive:   true,
+		},
+		"api_key": {
+			Description: "Base64 encoded API key to use for API authentication, used instead of `username` and `password`. Defaults to the `ELASTICSEARCH_API_KEY` environment variable.",
 			Type:        schema.TypeString,
-			Required:    true,
+			Optional:    true,
 			Sensitive:   true,
-			DefaultFunc: schema.MultiEnvDefaultFunc(
-				[]string{"ELASTICSEARCH_PASS", "ELASTICSEARCH_PASSWORD"}, "",
+		},
+		"ca_file": {
+			Description: "Path to a PEM-encoded custom Certificate Authority certificate. Defaults to the `ELASTICSEARCH_CA_FILE` environment variable.",
+			Type:        schema.TypeString,
+			Optional:    true,
+		},
+		"ca_data": {
+			Description: "PEM-encoded custom Certificate Authority certificate, used instead of `ca_file`.",
+			Type:        schema.TypeString,
+			Optional:    true,
+		},
+		"cert_file": {
+			Description:  "Path to a PEM-encoded client certificate used for mutual TLS.",
+			Type:         schema.TypeString,
+			Optional:     true,
+			RequiredWith: []string{"key_file"},
+		},
+		"key_file": {
+			Description:  "Path to the PEM-encoded private key of the client certificate.",
+			Type:         schema.TypeString,
+			Optional:     true,
+			RequiredWith: []string{"cert_file"},
+		},
+		"insecure": {
+			Description: "Disable TLS certificate verification.",
+			Type:        schema.TypeBool,
+			Optional:    true,
+			DefaultFunc: schema.EnvDefaultFunc(
+				"ELASTICSEARCH_INSECURE", false,
 			),
 		},
+		"elasticsearch": {
+			Description: "Elasticsearch connection settings, overriding the top-level attributes.",
+			Type:        schema.TypeList,
+			Optional:    true,
+			MaxItems:    1,
+			Elem: &schema.Resource{
+				Schema: elasticsearchConnectionSchema("elasticsearch.0."),
+			},
+		},
+		"kibana": {
+			Description: "Kibana connection settings, overriding the top-level attributes.",
+			Type:        schema.TypeList,
+			Optional:    true,
+			MaxItems:    1,
+			Elem: &schema.Resource{
+				Schema: kibanaConnectionSchema("kibana.0."),
+			},
+		},
+	}
+}
+
+func elasticsearchConnectionSchema(prefix string) map[string]*schema.Schema {
+	s := connectionSchema(prefix)
+	s["urls"] = &schema.Schema{
+		Description: "List of Elasticsearch URLs to use for API Authentication.",
+		Type:        schema.TypeList,
+		Optional:    true,
+		Elem: &schema.Schema{
+			Type: schema.TypeString,
+		},
 	}
+	return s
+}
+
+func kibanaConnectionSchema(prefix string) map[string]*schema.Schema {
+	s := connectionSchema(prefix)
+	s["url"] = &schema.Schema{
+		Description: "Kibana URL to use for API Authentication.",
+		Type:        schema.TypeString,
+		Optional:    true,
+	}
+	return s
 }
 
 func New(version string) func() *schema.Provider {
@@ -70,10 +170,14 @@ func New(version string) func() *schema.Provider {
 		p := &schema.Provider{
 			Schema: newSchema(),
 			ResourcesMap: map[string]*schema.Resource{
-				"elasticstack_auth_user":          resourceElasticstackAuthUser(),
-				"elasticstack_auth_role":          resourceElasticstackAuthRole(),
-				"elasticstack_auth_role_mapping":  resourceElasticstackAuthRoleMapping(),
-				"elasticstack_fleet_agent_policy": resourceElasticstackFleetAgentPolicy(),
+				"elasticstack_auth_user":                  resourceElasticstackAuthUser(),
+				"elasticstack_auth_role":                  resourceElasticstackAuthRole(),
+				"elasticstack_auth_role_mapping":          resourceElasticstackAuthRoleMapping(),
+				"elasticstack_auth_builtin_user_password": resourceElasticstackAuthBuiltinUserPassword(),
+				"elasticstack_auth_api_key":               resourceElasticstackAuthAPIKey(),
+				"elasticstack_auth_service_account_token": resourceElasticstackAuthServiceAccountToken(),
+				"elasticstack_auth_application_privilege": resourceElasticstackAuthApplicationPrivilege(),
+				"elasticstack_fleet_agent_policy":         resourceElasticstackFleetAgentPolicy(),
 			},
 		}
 
@@ -83,45 +187,194 @@ func New(version string) func() *schema.Provider {
 	}
 }
 
-type apiClient struct {
-	es *elasticsearch.Client
-	k  *resty.Client
-}
-
 func configure(version string, p *schema.Provider) func(context.Context, *schema.ResourceData) (interface{}, diag.Diagnostics) {
 	return func(ctx context.Context, d *schema.ResourceData) (interface{}, diag.Diagnostics) {
 		var diags diag.Diagnostics
 
-		username := d.Get("username").(string)
-		password := d.Get("password").(string)
-
-		es, err := elasticsearch.NewClient(elasticsearch.Config{
-			Addresses: []string{d.Get("elasticsearch_url").(string)},
-			Username:  username,
-			Password:  password,
-		})
+		username, password, apiKey, err := providerCredentials(d)
 		if err != nil {
-			diags = append(diags, diag.Diagnostic{
+			return nil, diag.FromErr(err)
+		}
+
+		caFile, caData := d.Get("ca_file").(string), d.Get("ca_data").(string)
+		if caFile != "" && caData != "" {
+			return nil, diag.Errorf("'ca_file' cannot be used together with 'ca_data'")
+		}
+		if caData == "" {
+			caFile = envDefault(caFile, "ELASTICSEARCH_CA_FILE")
+		}
+
+		base := connectionConfig{
+			username:      username,
+			password:      password,
+			apiKey:        apiKey,
+			caFile:        caFile,
+			caData:        caData,
+			certFile:      d.Get("cert_file").(string),
+			keyFile:       d.Get("key_file").(string),
+			insecure:      d.Get("insecure").(bool),
+			sniff:         d.Get("sniff").(bool),
+			maxRetries:    d.Get("max_retries").(int),
+			retryOnStatus: []int{429, 502, 503, 504},
+		}
+		if statuses := d.Get("retry_on_status").([]interface{}); len(statuses) > 0 {
+			base.retryOnStatus = expandIntList(statuses)
+		}
+
+		// URLs set in the configuration, including through its Cloud ID, take precedence over
+		// the environment variables
+		esConn := base
+		esConn.urls = expandStringList(d.Get("elasticsearch_urls").([]interface{}))
+		if esURL := d.Get("elasticsearch_url").(string); esURL != "" {
+			if len(esConn.urls) > 0 {
+				return nil, diag.Errorf("'elasticsearch_url' cannot be used together with 'elasticsearch_urls'")
+			}
+			esConn.urls = []string{esURL}
+		}
+		kibanaConn := base
+		if kibanaURL := d.Get("kibana_url").(string); kibanaURL != "" {
+			kibanaConn.urls = []string{kibanaURL}
+		}
+
+		cloudID := d.Get("cloud_id").(string)
+		if err := applyCloudID(cloudID, &esConn, &kibanaConn); err != nil {
+			return nil, diag.Diagnostics{{
 				Severity: diag.Error,
-				Summary:  "Unable to create Elasticsearch client",
+				Summary:  "Unable to decode Cloud ID",
 				Detail:   err.Error(),
-			})
+			}}
+		}
+		if esURL := os.Getenv("ELASTICSEARCH_URL"); esURL != "" && len(esConn.urls) == 0 {
+			esConn.urls = []string{esURL}
+		}
+		if kibanaURL := os.Getenv("KIBANA_URL"); kibanaURL != "" && len(kibanaConn.urls) == 0 {
+			kibanaConn.urls = []string{kibanaURL}
+		}
+		if cloudID == "" {
+			if err := applyCloudID(os.Getenv("ELASTIC_CLOUD_ID"), &esConn, &kibanaConn); err != nil {
+				return nil, diag.Diagnostics{{
+					Severity: diag.Error,
+					Summary:  "Unable to decode Cloud ID",
+					Detail:   err.Error(),
+				}}
+			}
 		}
 
-		k := resty.New().
-			SetHeader("kbn-xsrf", "true").
-			SetBasicAuth(username, password).
-			SetHostURL(d.Get("kibana_url").(string))
+		esConn = expandConnectionConfig(d, "elasticsearch", esConn)
+		kibanaConn = expandConnectionConfig(d, "kibana", kibanaConn)
 
-		_, err = k.R().Get("/")
+		if len(esConn.urls) == 0 {
+			return nil, diag.Errorf("either 'cloud_id', 'elasticsearch_url' or 'elasticsearch_urls' must be configured")
+		}
+		if !esConn.hasCredentials() {
+			return nil, diag.Errorf("either 'api_key', 'bearer_token' or both 'username' and 'password' must be configured")
+		}
+
+		es, err := newElasticsearchClient(esConn)
 		if err != nil {
 			diags = append(diags, diag.Diagnostic{
 				Severity: diag.Error,
-				Summary:  "Unable to create Kibana client",
+				Summary:  "Unable to create Elasticsearch client",
 				Detail:   err.Error(),
 			})
 		}
 
-		return apiClient{es, k}, diags
+		client := &apiClient{
+			es:     es,
+			esConn: esConn,
+		}
+		if len(kibanaConn.urls) > 0 {
+			client.kibanaURL = kibanaConn.urls[0]
+			client.newKibanaClient = func() (*resty.Client, error) {
+				return newKibanaClient(kibanaConn)
+			}
+		}
+
+		return client, diags
+	}
+}
+
+// envDefault returns v, or the value of the first of the environment variables that is set
+// when v is empty.
+func envDefault(v string, keys ...string) string {
+	if v != "" {
+		return v
+	}
+	for _, k := range keys {
+		if e := os.Getenv(k); e != "" {
+			return e
+		}
+	}
+	return ""
+}
+
+// providerCredentials resolves the top-level credentials. Attributes set in the configuration
+// take precedence over the environment variables, and only they are checked for conflicts so
+// that exported variables never conflict with the configuration.
+func providerCredentials(d *schema.ResourceData) (username string, password string, apiKey string, err error) {
+	username = d.Get("username").(string)
+	password = d.Get("password").(string)
+	apiKey = d.Get("api_key").(string)
+
+	if apiKey != "" && (username != "" || password != "") {
+		return "", "", "", fmt.Errorf("'api_key' cannot be used together with 'username' and 'password'")
+	}
+	if apiKey == "" && username == "" && password == "" {
+		apiKey = os.Getenv("ELASTICSEARCH_API_KEY")
+	}
+	if apiKey == "" {
+		username = envDefault(username, "ELASTICSEARCH_USER")
+		password = envDefault(password, "ELASTICSEARCH_PASS", "ELASTICSEARCH_PASSWORD")
+		if (username == "") != (password == "") {
+			return "", "", "", fmt.Errorf("'username' and 'password' must be set together")
+		}
+	}
+	return username, password, apiKey, nil
+}
+
+// applyCloudID sets the URLs derived from a Cloud ID on the connections that have none.
+func applyCloudID(cloudID string, esConn *connectionConfig, kibanaConn *connectionConfig) error {
+	if cloudID == "" {
+		return nil
+	}
+	esURL, kibanaURL, err := decodeCloudID(cloudID)
+	if err != nil {
+		return err
+	}
+	if len(esConn.urls) == 0 {
+		esConn.urls = []string{esURL}
+	}
+	if len(kibanaConn.urls) == 0 && kibanaURL != "" {
+		kibanaConn.urls = []string{kibanaURL}
+	}
+	return nil
+}
+
+// decodeCloudID extracts the Elasticsearch and Kibana endpoints from an Elastic Cloud ID,
+// which has the format "<name>:<base64(host$elasticsearch-id$kibana-id)>". The Kibana
+// endpoint is empty when the deployment has no Kibana instance.
+func decodeCloudID(cloudID string) (string, string, error) {
+	idx := strings.LastIndex(cloudID, ":")
+	data, err := base64.StdEncoding.DecodeString(cloudID[idx+1:])
+	if err != nil {
+		return "", "", fmt.Errorf("unable to decode Cloud ID: %w", err)
+	}
+
+	parts := strings.Split(strings.TrimSuffix(string(data), "\n"), "$")
+	if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("Cloud ID does not contain an Elasticsearch endpoint")
+	}
+
+	host := parts[0]
+	port := ""
+	if i := strings.LastIndex(host, ":"); i >= 0 {
+		host, port = host[:i], host[i:]
+	}
+
+	esURL := fmt.Sprintf("https://%s.%s%s", parts[1], host, port)
+	kibanaURL := ""
+	if len(parts) > 2 && parts[2] != "" {
+		kibanaURL = fmt.Sprintf("https://%s.%s%s", parts[2], host, port)
 	}
+	return esURL, kibanaURL, nil
 }
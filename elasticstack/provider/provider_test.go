@@ -1,7 +1,10 @@
 package provider
 
 import (
+	"context"
+	"encoding/base64"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
@@ -23,15 +26,274 @@ func TestProvider(t *testing.T) {
 	}
 }
 
+func TestElasticsearchConnectionForcesNew(t *testing.T) {
+	for name, r := range New("dev")().ResourcesMap {
+		s, ok := r.Schema["elasticsearch_connection"]
+		if !ok {
+			continue
+		}
+		if s.ForceNew {
+			t.Errorf("%s: expected 'elasticsearch_connection' to be updatable in place", name)
+		}
+		for k, v := range s.Elem.(*schema.Resource).Schema {
+			if forceNew := k == "urls"; v.ForceNew != forceNew {
+				t.Errorf("%s: expected ForceNew of 'elasticsearch_connection.0.%s' to be %t", name, k, forceNew)
+			}
+		}
+	}
+}
+
+func TestDecodeCloudID(t *testing.T) {
+	cloudID := "my-deployment:" + base64.StdEncoding.EncodeToString([]byte("us-east-1.aws.found.io:9243$es123$kb456"))
+
+	esURL, kibanaURL, err := decodeCloudID(cloudID)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if esURL != "https://es123.us-east-1.aws.found.io:9243" {
+		t.Fatalf("unexpected Elasticsearch URL: %s", esURL)
+	}
+	if kibanaURL != "https://kb456.us-east-1.aws.found.io:9243" {
+		t.Fatalf("unexpected Kibana URL: %s", kibanaURL)
+	}
+
+	_, kibanaURL, err = decodeCloudID("my-deployment:" + base64.StdEncoding.EncodeToString([]byte("host$es123")))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if kibanaURL != "" {
+		t.Fatalf("unexpected Kibana URL: %s", kibanaURL)
+	}
+
+	if _, _, err := decodeCloudID("my-deployment:" + base64.StdEncoding.EncodeToString([]byte("host"))); err == nil {
+		t.Fatal("expected an error for a Cloud ID without an Elasticsearch endpoint")
+	}
+}
+
+func testConfigure(t *testing.T, raw map[string]interface{}) (*apiClient, error) {
+	d := schema.TestResourceDataRaw(t, newSchema(), raw)
+	client, diags := configure("dev", nil)(context.Background(), d)
+	if diags.HasError() {
+		return nil, diagnosticsError(diags)
+	}
+	return client.(*apiClient), nil
+}
+
+func TestConfigureCredentials(t *testing.T) {
+	t.Setenv("ELASTICSEARCH_USER", "env-user")
+	t.Setenv("ELASTICSEARCH_PASSWORD", "env-password")
+	t.Setenv("ELASTICSEARCH_API_KEY", "")
+
+	client, err := testConfigure(t, map[string]interface{}{
+		"elasticsearch_url": "http://localhost:9200",
+		"api_key":           "config-key",
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if client.esConn.apiKey != "config-key" || client.esConn.username != "" {
+		t.Fatalf("expected the configured API key to take precedence, got %+v", client.esConn)
+	}
+
+	client, err = testConfigure(t, map[string]interface{}{
+		"elasticsearch_url": "http://localhost:9200",
+		"username":          "config-user",
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if client.esConn.username != "config-user" || client.esConn.password != "env-password" {
+		t.Fatalf("expected the configured username with the password of the environment, got %+v", client.esConn)
+	}
+
+	t.Setenv("ELASTICSEARCH_API_KEY", "env-key")
+	client, err = testConfigure(t, map[string]interface{}{
+		"elasticsearch_url": "http://localhost:9200",
+		"username":          "config-user",
+		"password":          "config-password",
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if client.esConn.apiKey != "" || client.esConn.username != "config-user" {
+		t.Fatalf("expected the configured username and password to take precedence, got %+v", client.esConn)
+	}
+
+	if _, err := testConfigure(t, map[string]interface{}{
+		"elasticsearch_url": "http://localhost:9200",
+		"username":          "config-user",
+		"api_key":           "config-key",
+	}); err == nil {
+		t.Fatal("expected an error when both 'api_key' and 'username' are configured")
+	}
+}
+
+func TestConfigureCA(t *testing.T) {
+	t.Setenv("ELASTICSEARCH_CA_FILE", "/env/ca.pem")
+
+	// the client cannot be created without the CA file, but the configuration is resolved
+	d := schema.TestResourceDataRaw(t, newSchema(), map[string]interface{}{
+		"elasticsearch_url": "http://localhost:9200",
+		"api_key":           "key",
+	})
+	client, _ := configure("dev", nil)(context.Background(), d)
+	if client == nil || client.(*apiClient).esConn.caFile != "/env/ca.pem" {
+		t.Fatalf("expected the CA file of the environment, got %+v", client)
+	}
+
+	_, err := testConfigure(t, map[string]interface{}{
+		"elasticsearch_url": "http://localhost:9200",
+		"api_key":           "key",
+		"ca_data":           "data",
+	})
+	if err == nil || !strings.Contains(err.Error(), "unable to parse CA certificate") {
+		t.Fatalf("expected 'ca_data' to take precedence over the environment, got %v", err)
+	}
+
+	if _, err := testConfigure(t, map[string]interface{}{
+		"elasticsearch_url": "http://localhost:9200",
+		"api_key":           "key",
+		"ca_file":           "/config/ca.pem",
+		"ca_data":           "data",
+	}); err == nil || !strings.Contains(err.Error(), "'ca_file' cannot be used together with 'ca_data'") {
+		t.Fatalf("expected a conflict between 'ca_file' and 'ca_data', got %v", err)
+	}
+}
+
+func TestConfigureURLs(t *testing.T) {
+	t.Setenv("ELASTICSEARCH_URL", "http://env:9200")
+
+	client, err := testConfigure(t, map[string]interface{}{
+		"elasticsearch_urls": []interface{}{"http://node1:9200", "http://node2:9200"},
+		"api_key":            "key",
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(client.esConn.urls) != 2 || client.esConn.urls[0] != "http://node1:9200" {
+		t.Fatalf("expected the configured URLs to take precedence, got %v", client.esConn.urls)
+	}
+
+	client, err = testConfigure(t, map[string]interface{}{
+		"api_key": "key",
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(client.esConn.urls) != 1 || client.esConn.urls[0] != "http://env:9200" {
+		t.Fatalf("expected the URL of the environment, got %v", client.esConn.urls)
+	}
+
+	if _, err := testConfigure(t, map[string]interface{}{
+		"elasticsearch_url":  "http://node1:9200",
+		"elasticsearch_urls": []interface{}{"http://node2:9200"},
+		"api_key":            "key",
+	}); err == nil {
+		t.Fatal("expected an error when both 'elasticsearch_url' and 'elasticsearch_urls' are configured")
+	}
+
+	t.Setenv("KIBANA_URL", "http://env:5601")
+	cloudID := "my-deployment:" + base64.StdEncoding.EncodeToString([]byte("us-east-1.aws.found.io:9243$es123$kb456"))
+	client, err = testConfigure(t, map[string]interface{}{
+		"cloud_id": cloudID,
+		"api_key":  "key",
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(client.esConn.urls) != 1 || client.esConn.urls[0] != "https://es123.us-east-1.aws.found.io:9243" {
+		t.Fatalf("expected the configured Cloud ID to take precedence over ELASTICSEARCH_URL, got %v", client.esConn.urls)
+	}
+	if client.kibanaURL != "https://kb456.us-east-1.aws.found.io:9243" {
+		t.Fatalf("expected the configured Cloud ID to take precedence over KIBANA_URL, got %s", client.kibanaURL)
+	}
+
+	t.Setenv("ELASTIC_CLOUD_ID", cloudID)
+	client, err = testConfigure(t, map[string]interface{}{
+		"api_key": "key",
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if client.esConn.urls[0] != "http://env:9200" || client.kibanaURL != "http://env:5601" {
+		t.Fatalf("expected the URLs of the environment to take precedence over ELASTIC_CLOUD_ID, got %v and %s", client.esConn.urls, client.kibanaURL)
+	}
+}
+
+func TestConfigureConnectionBlockInsecure(t *testing.T) {
+	client, err := testConfigure(t, map[string]interface{}{
+		"elasticsearch_url": "http://localhost:9200",
+		"api_key":           "key",
+		"insecure":          true,
+		"elasticsearch": []interface{}{
+			map[string]interface{}{
+				"insecure": "false",
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if client.esConn.insecure {
+		t.Fatal("expected 'insecure = false' in the elasticsearch block to restore verification")
+	}
+
+	kibanaConn := expandConnectionConfig(schema.TestResourceDataRaw(t, newSchema(), map[string]interface{}{
+		"insecure": true,
+		"kibana": []interface{}{
+			map[string]interface{}{
+				"url": "http://localhost:5601",
+			},
+		},
+	}), "kibana", connectionConfig{insecure: true})
+	if !kibanaConn.insecure {
+		t.Fatal("expected an unset 'insecure' in the kibana block to be inherited")
+	}
+}
+
+func TestExpandConnectionConfigFromState(t *testing.T) {
+	base := connectionConfig{urls: []string{"https://provider:9200"}, apiKey: "key", insecure: true}
+	r := resourceElasticstackAuthRole()
+
+	for _, c := range []struct {
+		insecure string
+		expected bool
+	}{
+		{"", true},
+		{"false", false},
+		{"true", true},
+	} {
+		block := map[string]interface{}{
+			"urls": []interface{}{"https://other:9200"},
+		}
+		if c.insecure != "" {
+			block["insecure"] = c.insecure
+		}
+		d := schema.TestResourceDataRaw(t, r.Schema, map[string]interface{}{
+			"name":                     "role",
+			"elasticsearch_connection": []interface{}{block},
+		})
+		d.SetId("role")
+
+		fromConfig := expandConnectionConfig(d, "elasticsearch_connection", base)
+		fromState := expandConnectionConfig(r.Data(d.State()), "elasticsearch_connection", base)
+		if fromConfig.insecure != c.expected || fromState.insecure != c.expected {
+			t.Errorf("insecure = %q: expected %t, got %t from config and %t from state", c.insecure, c.expected, fromConfig.insecure, fromState.insecure)
+		}
+	}
+}
+
 func testAccPreCheck(t *testing.T) {
-	if err := os.Getenv("KIBANA_URL"); err == "" {
-		t.Fatal("KIBANA_URL must be set for acceptance tests")
+	if os.Getenv("ELASTIC_CLOUD_ID") == "" {
+		if err := os.Getenv("ELASTICSEARCH_URL"); err == "" {
+			t.Fatal("ELASTICSEARCH_URL must be set for acceptance tests")
+		}
 	}
-	if err := os.Getenv("ELASTICSEARCH_URL"); err == "" {
-		t.Fatal("ELASTICSEARCH_URL must be set for acceptance tests")
+	if os.Getenv("ELASTICSEARCH_API_KEY") != "" {
+		return
 	}
 	if err := os.Getenv("ELASTICSEARCH_USER"); err == "" {
-		t.Fatal("ELASTICSEARCH_USER must be set for acceptance tests")
+		t.Fatal("ELASTICSEARCH_USER or ELASTICSEARCH_API_KEY must be set for acceptance tests")
 	}
 	if err := os.Getenv("ELASTICSEARCH_PASSWORD"); err == "" {
 		t.Fatal("ELASTICSEARCH_PASSWORD must be set for acceptance tests")
@@ -0,0 +1,286 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func resourceElasticstackAuthAPIKey() *schema.Resource {
+	roleDescriptorSchema := map[string]*schema.Schema{
+		"name": {
+			Type:     schema.TypeString,
+			Required: true,
+		},
+	}
+	for k, v := range rolePrivilegesSchema() {
+		roleDescriptorSchema[k] = v
+	}
+
+	return &schema.Resource{
+		Description: "Manages an API key. The key cannot be modified once created, any change other than the credentials of `elasticsearch_connection` replaces it.",
+
+		CreateContext: resourceElasticstackAuthAPIKeyCreate,
+		ReadContext:   resourceElasticstackAuthAPIKeyRead,
+		UpdateContext: resourceElasticstackAuthAPIKeyUpdate,
+		DeleteContext: resourceElasticstackAuthAPIKeyDelete,
+		CustomizeDiff: requireElasticsearchVersion("7.13", "metadata"),
+		Timeouts: &schema.ResourceTimeout{
+			Default: schema.DefaultTimeout(5 * time.Minute),
+		},
+
+		Schema: map[string]*schema.Schema{
+			"elasticsearch_connection": elasticsearchConnectionResourceSchema(),
+			"name": {
+				Type:     schema.TypeString,
+				Required: true,
+				ForceNew: true,
+			},
+			"role_descriptor": {
+				Type:        schema.TypeList,
+				Optional:    true,
+				ForceNew:    true,
+				Description: "Roles granted to the API key, limited by the privileges of the user creating it. Without role descriptors the key inherits a snapshot of the privileges of the user.",
+				Elem: &schema.Resource{
+					Schema: forceNewSchema(roleDescriptorSchema),
+				},
+			},
+			"expiration": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				ForceNew:    true,
+				Description: "Time after which the API key expires, such as `1d`. API keys do not expire by default.",
+			},
+			"metadata": {
+				Type:             schema.TypeString,
+				Optional:         true,
+				ForceNew:         true,
+				Description:      "Arbitrary metadata of the API key, as a JSON object. Requires Elasticsearch >= 7.13.",
+				ValidateFunc:     validateJSONObject,
+				DiffSuppressFunc: suppressEquivalentJSONDiffs,
+			},
+			"api_key": {
+				Type:      schema.TypeString,
+				Computed:  true,
+				Sensitive: true,
+			},
+			"encoded": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Sensitive:   true,
+				Description: "Base64 encoding of `id:api_key`, as used in the `Authorization: ApiKey` header.",
+			},
+		},
+	}
+}
+
+type esapiAPIKeyRequest struct {
+	Name            string                   `json:"name"`
+	RoleDescriptors map[string]esapiRoleData `json:"role_descriptors,omitempty"`
+	Expiration      string                   `json:"expiration,omitempty"`
+	Metadata        map[string]interface{}   `json:"metadata,omitempty"`
+}
+
+type esapiAPIKeyResponse struct {
+	Id      string `json:"id"`
+	Name    string `json:"name"`
+	APIKey  string `json:"api_key"`
+	Encoded string `json:"encoded"`
+}
+
+type esapiAPIKeyData struct {
+	Id          string                 `json:"id"`
+	Name        string                 `json:"name"`
+	Expiration  int64                  `json:"expiration,omitempty"`
+	Invalidated bool                   `json:"invalidated"`
+	Metadata    map[string]interface{} `json:"metadata"`
+}
+
+// expired returns whether the key expired, its expiration being in epoch milliseconds.
+func (k esapiAPIKeyData) expired(now time.Time) bool {
+	return k.Expiration > 0 && !now.Before(time.Unix(0, k.Expiration*int64(time.Millisecond)))
+}
+
+func parseAPIKeyData(d *schema.ResourceData) (esapiAPIKeyRequest, error) {
+	apiKey := esapiAPIKeyRequest{
+		Name:       d.Get("name").(string),
+		Expiration: d.Get("expiration").(string),
+	}
+
+	roleDescriptors := d.Get("role_descriptor").([]interface{})
+	if len(roleDescriptors) > 0 {
+		apiKey.RoleDescriptors = map[string]esapiRoleData{}
+	}
+	for _, r := range roleDescriptors {
+		descriptor := r.(map[string]interface{})
+		name := descriptor["name"].(string)
+		if _, ok := apiKey.RoleDescriptors[name]; ok {
+			return apiKey, fmt.Errorf("role descriptor '%s' is defined more than once", name)
+		}
+		role, err := expandRolePrivileges(func(k string) interface{} { return descriptor[k] })
+		if err != nil {
+			return apiKey, fmt.Errorf("invalid role descriptor '%s': %w", name, err)
+		}
+		apiKey.RoleDescriptors[name] = role
+	}
+
+	metadata, err := expandJSONObject(d.Get("metadata").(string))
+	if err != nil {
+		return apiKey, fmt.Errorf("unable to parse 'metadata': %w", err)
+	}
+	if len(metadata) > 0 {
+		apiKey.Metadata = metadata
+	}
+	return apiKey, nil
+}
+
+func resourceElasticstackAuthAPIKeyCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	es, err := meta.(*apiClient).elasticsearch(d)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	apiKeyData, err := parseAPIKeyData(d)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	bodyJson, err := json.Marshal(apiKeyData)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	req := esapi.SecurityCreateAPIKeyRequest{
+		Body: bytes.NewReader(bodyJson),
+	}
+
+	res, err := req.Do(ctx, es)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != 200 {
+		return elasticsearchError(res, "Unable to create API key")
+	}
+
+	var apiKey esapiAPIKeyResponse
+	if err := json.NewDecoder(res.Body).Decode(&apiKey); err != nil {
+		return diag.FromErr(err)
+	}
+
+	// the encoded key is only returned by Elasticsearch >= 7.16
+	encoded := apiKey.Encoded
+	if encoded == "" {
+		encoded = base64.StdEncoding.EncodeToString([]byte(apiKey.Id + ":" + apiKey.APIKey))
+	}
+
+	d.SetId(apiKey.Id)
+	d.Set("api_key", apiKey.APIKey)
+	d.Set("encoded", encoded)
+	return resourceElasticstackAuthAPIKeyRead(ctx, d, meta)
+}
+
+func resourceElasticstackAuthAPIKeyRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	es, err := meta.(*apiClient).elasticsearch(d)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	id := d.Id()
+
+	req := esapi.SecurityGetAPIKeyRequest{
+		ID: id,
+	}
+
+	res, err := req.Do(ctx, es)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == 404 {
+		log.Printf("[WARN] API key '%s' not found, removing from state", id)
+		d.SetId("")
+		return nil
+	}
+	if res.StatusCode != 200 {
+		return elasticsearchError(res, "Unable to get API key")
+	}
+
+	var apiKeyList struct {
+		APIKeys []esapiAPIKeyData `json:"api_keys"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&apiKeyList); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if len(apiKeyList.APIKeys) == 0 || apiKeyList.APIKeys[0].Invalidated {
+		log.Printf("[WARN] API key '%s' not found or invalidated, removing from state", id)
+		d.SetId("")
+		return nil
+	}
+	apiKeyData := apiKeyList.APIKeys[0]
+	if apiKeyData.expired(time.Now()) {
+		log.Printf("[WARN] API key '%s' expired, removing from state", id)
+		d.SetId("")
+		return nil
+	}
+
+	d.Set("name", apiKeyData.Name)
+
+	// metadata is only returned by Elasticsearch >= 7.13
+	if apiKeyData.Metadata != nil {
+		metadata, err := flattenJSONObject(apiKeyData.Metadata)
+		if err != nil {
+			return diag.FromErr(err)
+		}
+		d.Set("metadata", metadata)
+	}
+
+	return nil
+}
+
+func resourceElasticstackAuthAPIKeyUpdate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	// only the credentials of elasticsearch_connection can change in place, all other
+	// attributes force a new key
+	return resourceElasticstackAuthAPIKeyRead(ctx, d, meta)
+}
+
+func resourceElasticstackAuthAPIKeyDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	es, err := meta.(*apiClient).elasticsearch(d)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	bodyJson, err := json.Marshal(map[string]interface{}{
+		"ids": []string{d.Id()},
+	})
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	req := esapi.SecurityInvalidateAPIKeyRequest{
+		Body: bytes.NewReader(bodyJson),
+	}
+
+	res, err := req.Do(ctx, es)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != 200 && res.StatusCode != 404 {
+		return elasticsearchError(res, "Unable to invalidate API key")
+	}
+
+	return nil
+}
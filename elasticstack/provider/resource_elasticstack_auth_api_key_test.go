@@ -0,0 +1,136 @@
+package provider
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func TestParseAPIKeyData(t *testing.T) {
+	d := schema.TestResourceDataRaw(t, resourceElasticstackAuthAPIKey().Schema, map[string]interface{}{
+		"name":       "deploy",
+		"expiration": "1d",
+		"metadata":   `{"team": "platform"}`,
+		"role_descriptor": []interface{}{
+			map[string]interface{}{
+				"name":               "writer",
+				"cluster_privileges": []interface{}{"monitor"},
+				"index_privilege": []interface{}{
+					map[string]interface{}{
+						"indices":    []interface{}{"logs-*"},
+						"privileges": []interface{}{"write"},
+					},
+				},
+				"application_privilege": []interface{}{
+					map[string]interface{}{
+						"application": "myapp",
+						"privileges":  []interface{}{"read"},
+						"resources":   []interface{}{"*"},
+					},
+				},
+				"global_privileges": `{"application": {"manage": {"applications": ["myapp"]}}}`,
+				"kibana_privilege": []interface{}{
+					map[string]interface{}{
+						"spaces": []interface{}{"*"},
+						"base":   []interface{}{"read"},
+					},
+				},
+			},
+		},
+	})
+
+	apiKey, err := parseAPIKeyData(d)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if apiKey.Name != "deploy" || apiKey.Expiration != "1d" || apiKey.Metadata["team"] != "platform" {
+		t.Fatalf("unexpected API key: %+v", apiKey)
+	}
+
+	role, ok := apiKey.RoleDescriptors["writer"]
+	if !ok {
+		t.Fatalf("expected a 'writer' role descriptor, got %v", apiKey.RoleDescriptors)
+	}
+	if !reflect.DeepEqual(role.Cluster, []string{"monitor"}) {
+		t.Fatalf("unexpected cluster privileges: %v", role.Cluster)
+	}
+	if len(role.Indices) != 1 || !reflect.DeepEqual(role.Indices[0].Names, []string{"logs-*"}) {
+		t.Fatalf("unexpected index privileges: %+v", role.Indices)
+	}
+	if _, ok := role.Global["application"]; !ok {
+		t.Fatalf("unexpected global privileges: %v", role.Global)
+	}
+	expectedApplications := []esapiRoleDataApplication{
+		{Application: "myapp", Privileges: []string{"read"}, Resources: []string{"*"}},
+		{Application: kibanaApplication, Privileges: []string{"read"}, Resources: []string{"*"}},
+	}
+	if !reflect.DeepEqual(role.Applications, expectedApplications) {
+		t.Fatalf("unexpected application privileges: %+v", role.Applications)
+	}
+}
+
+func TestParseAPIKeyDataDuplicateRoleDescriptors(t *testing.T) {
+	d := schema.TestResourceDataRaw(t, resourceElasticstackAuthAPIKey().Schema, map[string]interface{}{
+		"name": "deploy",
+		"role_descriptor": []interface{}{
+			map[string]interface{}{
+				"name":               "reader",
+				"cluster_privileges": []interface{}{"monitor"},
+			},
+			map[string]interface{}{
+				"name":               "reader",
+				"cluster_privileges": []interface{}{"manage"},
+			},
+		},
+	})
+
+	_, err := parseAPIKeyData(d)
+	if err == nil || !strings.Contains(err.Error(), "'reader' is defined more than once") {
+		t.Fatalf("expected an error for duplicate role descriptors, got %v", err)
+	}
+}
+
+func TestParseAPIKeyDataInvalidKibanaPrivilege(t *testing.T) {
+	d := schema.TestResourceDataRaw(t, resourceElasticstackAuthAPIKey().Schema, map[string]interface{}{
+		"name": "deploy",
+		"role_descriptor": []interface{}{
+			map[string]interface{}{
+				"name": "kibana",
+				"kibana_privilege": []interface{}{
+					map[string]interface{}{
+						"spaces":   []interface{}{"marketing"},
+						"reserved": []interface{}{"ml_user"},
+					},
+				},
+			},
+		},
+	})
+
+	_, err := parseAPIKeyData(d)
+	if err == nil || !strings.Contains(err.Error(), "invalid role descriptor 'kibana'") {
+		t.Fatalf("expected an error for the role descriptor, got %v", err)
+	}
+}
+
+func TestAPIKeyExpired(t *testing.T) {
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	nowMillis := now.UnixNano() / int64(time.Millisecond)
+
+	cases := []struct {
+		expiration int64
+		expired    bool
+	}{
+		{0, false},
+		{nowMillis + 1000, false},
+		{nowMillis, true},
+		{nowMillis - 1000, true},
+	}
+	for _, c := range cases {
+		if expired := (esapiAPIKeyData{Expiration: c.expiration}).expired(now); expired != c.expired {
+			t.Errorf("expiration %d: expected %t, got %t", c.expiration, c.expired, expired)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func resourceElasticstackAuthApplicationPrivilege() *schema.Resource {
+	return &schema.Resource{
+		Description: "Manages a privilege of a custom application, which can then be granted with the `application_privilege` blocks of `elasticstack_auth_role`.",
+
+		CreateContext: resourceElasticstackAuthApplicationPrivilegeCreate,
+		ReadContext:   resourceElasticstackAuthApplicationPrivilegeRead,
+		UpdateContext: resourceElasticstackAuthApplicationPrivilegeUpdate,
+		DeleteContext: resourceElasticstackAuthApplicationPrivilegeDelete,
+		Importer: &schema.ResourceImporter{
+			StateContext: schema.ImportStatePassthroughContext,
+		},
+		Timeouts: &schema.ResourceTimeout{
+			Default: schema.DefaultTimeout(5 * time.Minute),
+		},
+
+		Schema: map[string]*schema.Schema{
+			"elasticsearch_connection": elasticsearchConnectionResourceSchema(),
+			"application": {
+				Type:     schema.TypeString,
+				Required: true,
+				ForceNew: true,
+			},
+			"name": {
+				Type:     schema.TypeString,
+				Required: true,
+				ForceNew: true,
+			},
+			"actions": {
+				Type:        schema.TypeList,
+				Required:    true,
+				MinItems:    1,
+				Description: "Actions granted by the privilege, such as `data:read/*` or `action:login`.",
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+			"metadata": {
+				Type:             schema.TypeString,
+				Optional:         true,
+				Description:      "Arbitrary metadata of the privilege, as a JSON object.",
+				ValidateFunc:     validateJSONObject,
+				DiffSuppressFunc: suppressEquivalentJSONDiffs,
+			},
+		},
+	}
+}
+
+type esapiApplicationPrivilegeData struct {
+	Application string                 `json:"-"`
+	Name        string                 `json:"-"`
+	Actions     []string               `json:"actions"`
+	Metadata    map[string]interface{} `json:"metadata,omitempty"`
+}
+
+func parseApplicationPrivilegeData(d *schema.ResourceData) (esapiApplicationPrivilegeData, error) {
+	privilege := esapiApplicationPrivilegeData{
+		Application: d.Get("application").(string),
+		Name:        d.Get("name").(string),
+		Actions:     expandStringList(d.Get("actions").([]interface{})),
+	}
+	metadata, err := expandJSONObject(d.Get("metadata").(string))
+	if err != nil {
+		return privilege, fmt.Errorf("unable to parse 'metadata': %w", err)
+	}
+	if len(metadata) > 0 {
+		privilege.Metadata = metadata
+	}
+	return privilege, nil
+}
+
+func parseApplicationPrivilegeId(id string) (application, name string, err error) {
+	parts := strings.SplitN(id, "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("unexpected format of ID (%s), expected application/name", id)
+	}
+	return parts[0], parts[1], nil
+}
+
+func resourceElasticstackAuthApplicationPrivilegeCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	es, err := meta.(*apiClient).elasticsearch(d)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	privilegeData, err := parseApplicationPrivilegeData(d)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	bodyJson, err := json.Marshal(map[string]map[string]esapiApplicationPrivilegeData{
+		privilegeData.Application: {
+			privilegeData.Name: privilegeData,
+		},
+	})
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	req := esapi.SecurityPutPrivilegesRequest{
+		Body: bytes.NewReader(bodyJson),
+	}
+
+	res, err := req.Do(ctx, es)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != 200 {
+		return elasticsearchError(res, "Unable to create application privilege")
+	}
+
+	d.SetId(fmt.Sprintf("%s/%s", privilegeData.Application, privilegeData.Name))
+	return resourceElasticstackAuthApplicationPrivilegeRead(ctx, d, meta)
+}
+
+func resourceElasticstackAuthApplicationPrivilegeRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	es, err := meta.(*apiClient).elasticsearch(d)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	application, name, err := parseApplicationPrivilegeId(d.Id())
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	req := esapi.SecurityGetPrivilegesRequest{
+		Application: application,
+		Name:        name,
+	}
+
+	res, err := req.Do(ctx, es)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == 404 {
+		log.Printf("[WARN] application privilege '%s' not found, removing from state", d.Id())
+		d.SetId("")
+		return nil
+	}
+	if res.StatusCode != 200 {
+		return elasticsearchError(res, "Unable to get application privilege")
+	}
+
+	var privilegeDataList map[string]map[string]esapiApplicationPrivilegeData
+	if err := json.NewDecoder(res.Body).Decode(&privilegeDataList); err != nil {
+		return diag.FromErr(err)
+	}
+
+	privilegeData, ok := privilegeDataList[application][name]
+	if !ok {
+		log.Printf("[WARN] application privilege '%s' not found, removing from state", d.Id())
+		d.SetId("")
+		return nil
+	}
+
+	d.Set("application", application)
+	d.Set("name", name)
+	d.Set("actions", privilegeData.Actions)
+
+	metadata, err := flattenJSONObject(privilegeData.Metadata)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	d.Set("metadata", metadata)
+
+	return nil
+}
+
+func resourceElasticstackAuthApplicationPrivilegeUpdate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	return resourceElasticstackAuthApplicationPrivilegeCreate(ctx, d, meta)
+}
+
+func resourceElasticstackAuthApplicationPrivilegeDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	es, err := meta.(*apiClient).elasticsearch(d)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	application, name, err := parseApplicationPrivilegeId(d.Id())
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	req := esapi.SecurityDeletePrivilegesRequest{
+		Application: application,
+		Name:        name,
+	}
+
+	res, err := req.Do(ctx, es)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != 200 && res.StatusCode != 404 {
+		return elasticsearchError(res, "Unable to delete application privilege")
+	}
+
+	return nil
+}
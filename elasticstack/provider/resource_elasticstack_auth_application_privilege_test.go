@@ -0,0 +1,21 @@
+package provider
+
+import (
+	"testing"
+)
+
+func TestParseApplicationPrivilegeId(t *testing.T) {
+	application, name, err := parseApplicationPrivilegeId("myapp/read")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if application != "myapp" || name != "read" {
+		t.Fatalf("unexpected ID parts: %s, %s", application, name)
+	}
+
+	for _, id := range []string{"myapp", "myapp/", "/read", ""} {
+		if _, _, err := parseApplicationPrivilegeId(id); err == nil {
+			t.Errorf("%q: expected an error", id)
+		}
+	}
+}
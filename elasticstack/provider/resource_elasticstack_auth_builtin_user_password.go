@@ -0,0 +1,187 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v7"
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func resourceElasticstackAuthBuiltinUserPassword() *schema.Resource {
+	return &schema.Resource{
+		Description: "Manages the password of a built-in user such as `elastic` or `kibana_system`. Built-in users are never deleted, destroying the resource only removes it from the state.",
+
+		CreateContext: resourceElasticstackAuthBuiltinUserPasswordCreate,
+		ReadContext:   resourceElasticstackAuthBuiltinUserPasswordRead,
+		UpdateContext: resourceElasticstackAuthBuiltinUserPasswordUpdate,
+		DeleteContext: resourceElasticstackAuthBuiltinUserPasswordDelete,
+		Importer: &schema.ResourceImporter{
+			StateContext: schema.ImportStatePassthroughContext,
+		},
+		Timeouts: &schema.ResourceTimeout{
+			Default: schema.DefaultTimeout(5 * time.Minute),
+		},
+		CustomizeDiff: validateUserPasswordHashAlgorithm,
+
+		Schema: map[string]*schema.Schema{
+			"elasticsearch_connection": elasticsearchConnectionResourceSchema(),
+			"username": {
+				Type:     schema.TypeString,
+				Required: true,
+				ForceNew: true,
+			},
+			"password": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Sensitive:    true,
+				ExactlyOneOf: []string{"password", "password_hash"},
+			},
+			"password_hash": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Sensitive:    true,
+				Description:  "Hash of the password, which must use the hashing algorithm configured in the cluster (`$2a$` for bcrypt, `{PBKDF2}` for PBKDF2).",
+				ExactlyOneOf: []string{"password", "password_hash"},
+				ValidateFunc: validatePasswordHashFormat,
+			},
+			"password_version": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "Arbitrary value that triggers a password change when modified, even if `password` or `password_hash` did not change.",
+			},
+			"enabled": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     true,
+				Description: "Whether the user is enabled, disabled users cannot authenticate.",
+			},
+		},
+	}
+}
+
+// getBuiltinUser returns a reserved user, or nil if the user does not exist.
+func getBuiltinUser(ctx context.Context, es *elasticsearch.Client, username string) (*esapiUserData, diag.Diagnostics) {
+	req := esapi.SecurityGetUserRequest{
+		Username: []string{username},
+	}
+
+	res, err := req.Do(ctx, es)
+	if err != nil {
+		return nil, diag.FromErr(err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == 404 {
+		return nil, nil
+	}
+	if res.StatusCode != 200 {
+		return nil, elasticsearchError(res, "Unable to get user")
+	}
+
+	var userDataList map[string]esapiUserData
+	if err := json.NewDecoder(res.Body).Decode(&userDataList); err != nil {
+		return nil, diag.FromErr(err)
+	}
+
+	userData, ok := userDataList[username]
+	if !ok {
+		return nil, nil
+	}
+	if reserved, _ := userData.Metadata["_reserved"].(bool); !reserved {
+		return nil, diag.Errorf("user '%s' is not a built-in user, use the elasticstack_auth_user resource to manage it", username)
+	}
+
+	return &userData, nil
+}
+
+func resourceElasticstackAuthBuiltinUserPasswordCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	es, err := meta.(*apiClient).elasticsearch(d)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	username := d.Get("username").(string)
+
+	userData, diags := getBuiltinUser(ctx, es, username)
+	if diags.HasError() {
+		return diags
+	}
+	if userData == nil {
+		return diag.Errorf("built-in user '%s' does not exist", username)
+	}
+
+	if diags := changeUserPassword(ctx, es, username, d.Get("password").(string), d.Get("password_hash").(string)); diags.HasError() {
+		return diags
+	}
+
+	if enabled := d.Get("enabled").(bool); enabled != userData.Enabled {
+		if diags := setUserEnabled(ctx, es, username, enabled); diags.HasError() {
+			return diags
+		}
+	}
+
+	d.SetId(username)
+	return resourceElasticstackAuthBuiltinUserPasswordRead(ctx, d, meta)
+}
+
+func resourceElasticstackAuthBuiltinUserPasswordRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	es, err := meta.(*apiClient).elasticsearch(d)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	username := d.Id()
+
+	userData, diags := getBuiltinUser(ctx, es, username)
+	if diags.HasError() {
+		return diags
+	}
+	if userData == nil {
+		log.Printf("[WARN] built-in user '%s' not found, removing from state", username)
+		d.SetId("")
+		return nil
+	}
+
+	d.Set("username", username)
+	d.Set("enabled", userData.Enabled)
+
+	return nil
+}
+
+func resourceElasticstackAuthBuiltinUserPasswordUpdate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	es, err := meta.(*apiClient).elasticsearch(d)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	username := d.Id()
+
+	if d.HasChanges("password", "password_hash", "password_version") {
+		if diags := changeUserPassword(ctx, es, username, d.Get("password").(string), d.Get("password_hash").(string)); diags.HasError() {
+			return diags
+		}
+	}
+
+	if d.HasChange("enabled") {
+		if diags := setUserEnabled(ctx, es, username, d.Get("enabled").(bool)); diags.HasError() {
+			return diags
+		}
+	}
+
+	return resourceElasticstackAuthBuiltinUserPasswordRead(ctx, d, meta)
+}
+
+func resourceElasticstackAuthBuiltinUserPasswordDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	log.Printf("[INFO] built-in user '%s' cannot be deleted, only removing it from state", d.Id())
+	return diag.Diagnostics{{
+		Severity: diag.Warning,
+		Summary:  fmt.Sprintf("Built-in user '%s' was not deleted", d.Id()),
+		Detail:   "Built-in users cannot be deleted, the resource was only removed from the Terraform state and the user keeps its current password.",
+	}}
+}
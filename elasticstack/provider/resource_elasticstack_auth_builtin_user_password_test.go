@@ -0,0 +1,42 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestGetBuiltinUser(t *testing.T) {
+	es := testElasticsearchClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/_security/user/elastic":
+			fmt.Fprint(w, `{"elastic": {"username": "elastic", "roles": ["superuser"], "enabled": true, "metadata": {"_reserved": true}}}`)
+		case "/_security/user/jdoe":
+			fmt.Fprint(w, `{"jdoe": {"username": "jdoe", "roles": [], "enabled": true, "metadata": {}}}`)
+		default:
+			w.WriteHeader(404)
+			fmt.Fprint(w, `{}`)
+		}
+	})
+
+	user, diags := getBuiltinUser(context.Background(), es, "elastic")
+	if diags.HasError() {
+		t.Fatalf("err: %v", diags)
+	}
+	if user == nil || !user.Enabled {
+		t.Fatalf("expected the built-in user to be returned, got %+v", user)
+	}
+
+	if _, diags := getBuiltinUser(context.Background(), es, "jdoe"); !diags.HasError() {
+		t.Fatal("expected an error for a user that is not reserved")
+	}
+
+	user, diags = getBuiltinUser(context.Background(), es, "missing")
+	if diags.HasError() {
+		t.Fatalf("err: %v", diags)
+	}
+	if user != nil {
+		t.Fatalf("expected no user, got %+v", user)
+	}
+}
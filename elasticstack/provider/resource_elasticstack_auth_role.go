@@ -5,193 +5,92 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"regexp"
+	"log"
+	"time"
 
 	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 )
 
 func resourceElasticstackAuthRole() *schema.Resource {
+	roleSchema := map[string]*schema.Schema{
+		"elasticsearch_connection": elasticsearchConnectionResourceSchema(),
+		"name": {
+			Type:     schema.TypeString,
+			Required: true,
+			ForceNew: true,
+		},
+		"metadata": {
+			Type:             schema.TypeString,
+			Optional:         true,
+			Description:      "Arbitrary metadata of the role, as a JSON object.",
+			ValidateFunc:     validateJSONObject,
+			DiffSuppressFunc: suppressEquivalentJSONDiffs,
+		},
+		"transient_metadata": {
+			Type:        schema.TypeString,
+			Computed:    true,
+			Description: "Metadata maintained by Elasticsearch, as a JSON object.",
+		},
+		"enabled": {
+			Type:        schema.TypeBool,
+			Computed:    true,
+			Description: "Whether the role is enabled, Elasticsearch disables roles using unknown privileges.",
+		},
+	}
+	for k, v := range rolePrivilegesSchema() {
+		roleSchema[k] = v
+	}
+
 	return &schema.Resource{
-		Create: resourceElasticstackAuthRoleCreate,
-		Read:   resourceElasticstackAuthRoleRead,
-		Update: resourceElasticstackAuthRoleUpdate,
-		Delete: resourceElasticstackAuthRoleDelete,
+		CreateContext: resourceElasticstackAuthRoleCreate,
+		ReadContext:   resourceElasticstackAuthRoleRead,
+		UpdateContext: resourceElasticstackAuthRoleUpdate,
+		DeleteContext: resourceElasticstackAuthRoleDelete,
 		Importer: &schema.ResourceImporter{
 			StateContext: schema.ImportStatePassthroughContext,
 		},
-
-		Schema: map[string]*schema.Schema{
-			"name": {
-				Type:     schema.TypeString,
-				Required: true,
-			},
-			"cluster_privileges": {
-				Type:     schema.TypeList,
-				Optional: true,
-				Elem: &schema.Schema{
-					Type: schema.TypeString,
-				},
-			},
-			"run_as_privileges": {
-				Type:     schema.TypeList,
-				Optional: true,
-				Elem: &schema.Schema{
-					Type: schema.TypeString,
-				},
-			},
-			"index_privilege": {
-				Type:     schema.TypeList,
-				Optional: true,
-				Elem: &schema.Resource{
-					Schema: map[string]*schema.Schema{
-						"indices": {
-							Type:     schema.TypeList,
-							Required: true,
-							Elem: &schema.Schema{
-								Type: schema.TypeString,
-							},
-						},
-						"privileges": {
-							Type:     schema.TypeList,
-							Required: true,
-							Elem: &schema.Schema{
-								Type: schema.TypeString,
-							},
-						},
-						"granted_fields": {
-							Type:     schema.TypeList,
-							Optional: true,
-							Elem: &schema.Schema{
-								Type: schema.TypeString,
-							},
-						},
-						"denied_fields": {
-							Type:     schema.TypeList,
-							Optional: true,
-							Elem: &schema.Schema{
-								Type: schema.TypeString,
-							},
-						},
-						"allow_restricted_indices": {
-							Type:     schema.TypeBool,
-							Optional: true,
-							Default:  false,
-						},
-					},
-				},
-			},
-			"kibana_privilege": {
-				Type:     schema.TypeList,
-				Optional: true,
-				Elem: &schema.Resource{
-					Schema: map[string]*schema.Schema{
-						"spaces": {
-							Type:     schema.TypeList,
-							Required: true,
-							MinItems: 1,
-							Elem: &schema.Schema{
-								Type: schema.TypeString,
-							},
-						},
-						"privileges": {
-							Type:     schema.TypeList,
-							Optional: true,
-							Elem: &schema.Schema{
-								Type: schema.TypeString,
-							},
-						},
-					},
-				},
-			},
+		CustomizeDiff: validateKibanaFeatures,
+		Timeouts: &schema.ResourceTimeout{
+			Default: schema.DefaultTimeout(5 * time.Minute),
 		},
-	}
-}
-
-type esapiRoleDataIndex struct {
-	Names         []string `json:"names"`
-	Privileges    []string `json:"privileges"`
-	FieldSecurity struct {
-		Grant  []string `json:"grant"`
-		Except []string `json:"except"`
-	} `json:"field_security,omitempty"`
-	Query                  string `json:"query"`
-	AllowRestrictedIndices bool   `json:"allow_restricted_indices"`
-}
 
-type esapiRoleDataApplication struct {
-	Application string   `json:"application"`
-	Privileges  []string `json:"privileges"`
-	Resources   []string `json:"resources"`
-}
-
-type esapiRoleData struct {
-	Name    string   `json:"-"`
-	RunAs   []string `json:"run_as,omitempty"`
-	Cluster []string `json:"cluster,omitempty"`
-	Global  *struct {
-		Application struct {
-			Applications []string `json:"applications,omitempty"`
-		} `json:"application,omitempty"`
-	} `json:"global,omitempty"`
-	Indices      []esapiRoleDataIndex       `json:"indices,omitempty"`
-	Applications []esapiRoleDataApplication `json:"applications,omitempty"`
+		Schema: roleSchema,
+	}
 }
 
 func parseRoleData(d *schema.ResourceData) (esapiRoleData, error) {
-	role := esapiRoleData{
-		Name:    d.Get("name").(string),
-		RunAs:   expandStringList(d.Get("run_as_privileges").([]interface{})),
-		Cluster: expandStringList(d.Get("cluster_privileges").([]interface{})),
-	}
-	indexPrivileges := d.Get("index_privilege").([]interface{})
-	if len(indexPrivileges) > 0 {
-		role.Indices = []esapiRoleDataIndex{}
-	}
-	for _, p := range indexPrivileges {
-		privilege := p.(map[string]interface{})
-		privilegeStruct := esapiRoleDataIndex{
-			Names:                  expandStringList(privilege["indices"].([]interface{})),
-			Privileges:             expandStringList(privilege["privileges"].([]interface{})),
-			AllowRestrictedIndices: privilege["allow_restricted_indices"].(bool),
-		}
-		privilegeStruct.FieldSecurity.Grant = expandStringList(privilege["granted_fields"].([]interface{}))
-		privilegeStruct.FieldSecurity.Except = expandStringList(privilege["denied_fields"].([]interface{}))
-		role.Indices = append(role.Indices, privilegeStruct)
+	role, err := expandRolePrivileges(d.Get)
+	if err != nil {
+		return role, err
 	}
-	kibanaPrivileges := d.Get("kibana_privilege").([]interface{})
-	if len(kibanaPrivileges) > 0 {
-		role.Applications = []esapiRoleDataApplication{}
+	role.Name = d.Get("name").(string)
+
+	metadata, err := expandJSONObject(d.Get("metadata").(string))
+	if err != nil {
+		return role, fmt.Errorf("unable to parse 'metadata': %w", err)
 	}
-	for _, p := range kibanaPrivileges {
-		privilege := p.(map[string]interface{})
-		privilegeStruct := esapiRoleDataApplication{
-			Application: "kibana-.kibana",
-			Privileges:  expandStringList(privilege["privileges"].([]interface{})),
-			Resources:   []string{},
-		}
-		for _, v := range expandStringList(privilege["spaces"].([]interface{})) {
-			if v != "*" {
-				v = fmt.Sprintf("space:%s", v)
-			}
-			privilegeStruct.Resources = append(privilegeStruct.Resources, v)
-		}
-		role.Applications = append(role.Applications, privilegeStruct)
+	if len(metadata) > 0 {
+		role.Metadata = metadata
 	}
 	return role, nil
 }
 
-func resourceElasticstackAuthRoleCreate(d *schema.ResourceData, meta interface{}) error {
-	es := meta.(apiClient).es
+func resourceElasticstackAuthRoleCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	es, err := meta.(*apiClient).elasticsearch(d)
+	if err != nil {
+		return diag.FromErr(err)
+	}
 
 	roleData, err := parseRoleData(d)
 	if err != nil {
-		return err
+		return diag.FromErr(err)
 	}
 
 	bodyJson, err := json.Marshal(roleData)
 	if err != nil {
-		return err
+		return diag.FromErr(err)
 	}
 
 	req := esapi.SecurityPutRoleRequest{
@@ -199,46 +98,60 @@ func resourceElasticstackAuthRoleCreate(d *schema.ResourceData, meta interface{}
 		Body: bytes.NewReader(bodyJson),
 	}
 
-	res, err := req.Do(context.Background(), es)
+	res, err := req.Do(ctx, es)
 	if err != nil {
-		return err
+		return diag.FromErr(err)
 	}
 	defer res.Body.Close()
 
 	if res.StatusCode != 200 {
-		return fmt.Errorf("%s", res)
+		return elasticsearchError(res, "Unable to create role")
 	}
 
-	return resourceElasticstackAuthRoleRead(d, meta)
+	d.SetId(roleData.Name)
+	return resourceElasticstackAuthRoleRead(ctx, d, meta)
 }
 
-func resourceElasticstackAuthRoleRead(d *schema.ResourceData, meta interface{}) error {
-	es := meta.(apiClient).es
+func resourceElasticstackAuthRoleRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	es, err := meta.(*apiClient).elasticsearch(d)
+	if err != nil {
+		return diag.FromErr(err)
+	}
 
-	name := d.Get("name").(string)
+	name := d.Id()
 
 	req := esapi.SecurityGetRoleRequest{
 		Name: []string{name},
 	}
 
-	res, err := req.Do(context.Background(), es)
+	res, err := req.Do(ctx, es)
 	if err != nil {
-		return err
+		return diag.FromErr(err)
 	}
 	defer res.Body.Close()
 
+	if res.StatusCode == 404 {
+		log.Printf("[WARN] role '%s' not found, removing from state", name)
+		d.SetId("")
+		return nil
+	}
 	if res.StatusCode != 200 {
-		return fmt.Errorf("%s", res)
+		return elasticsearchError(res, "Unable to get role")
 	}
 
 	var roleDataList map[string]esapiRoleData
 	err = json.NewDecoder(res.Body).Decode(&roleDataList)
 	if err != nil {
-		return err
+		return diag.FromErr(err)
+	}
+
+	roleData, ok := roleDataList[name]
+	if !ok {
+		log.Printf("[WARN] role '%s' not found, removing from state", name)
+		d.SetId("")
+		return nil
 	}
 
-	d.SetId(name)
-	roleData := roleDataList[name]
 	d.Set("name", name)
 	d.Set("run_as_privileges", collapseStringList(roleData.RunAs))
 	d.Set("cluster_privileges", collapseStringList(roleData.Cluster))
@@ -250,61 +163,88 @@ func resourceElasticstackAuthRoleRead(d *schema.ResourceData, meta interface{})
 			"privileges":               i.Privileges,
 			"granted_fields":           i.FieldSecurity.Grant,
 			"denied_fields":            i.FieldSecurity.Except,
+			"query":                    i.Query,
 			"allow_restricted_indices": i.AllowRestrictedIndices,
 		})
 	}
 	d.Set("index_privilege", indices)
 
-	spacesRegex := regexp.MustCompile(`^space:(.+)$`)
+	global, err := flattenJSONObject(roleData.Global)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	d.Set("global_privileges", global)
 
+	applicationPrivileges := make([]interface{}, 0)
 	kibanaPrivileges := make([]interface{}, 0)
 	for _, a := range roleData.Applications {
-		spaces := []string{}
-		if a.Application != "kibana-.kibana" {
-			return fmt.Errorf("the application '%s' is not supported for privilege management", a.Application)
+		// keep using the deprecated raw privileges if the block in the state does
+		rawPrivileges, _ := d.Get(fmt.Sprintf("kibana_privilege.%d.privileges", len(kibanaPrivileges))).([]interface{})
+		if privilege, ok := flattenKibanaPrivilege(a, len(rawPrivileges) > 0); ok {
+			kibanaPrivileges = append(kibanaPrivileges, privilege)
+			continue
 		}
-		for _, r := range a.Resources {
-			spacesMatches := spacesRegex.FindStringSubmatch(r)
-			if spacesMatches != nil {
-				spaces = append(spaces, spacesMatches[1])
-				continue
-			}
-			if r == "*" {
-				spaces = append(spaces, r)
-				continue
-			}
-			return fmt.Errorf("the resource condition '%s' is not supported for privilege management", r)
-		}
-		kibanaPrivileges = append(kibanaPrivileges, map[string]interface{}{
-			"spaces":     collapseStringList(spaces),
-			"privileges": collapseStringList(a.Privileges),
+		applicationPrivileges = append(applicationPrivileges, map[string]interface{}{
+			"application": a.Application,
+			"privileges":  collapseStringList(a.Privileges),
+			"resources":   collapseStringList(a.Resources),
 		})
 	}
+	d.Set("application_privilege", applicationPrivileges)
 	d.Set("kibana_privilege", kibanaPrivileges)
 
+	metadata, err := flattenJSONObject(roleData.Metadata)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	d.Set("metadata", metadata)
+
+	transientMetadata, err := flattenJSONObject(roleData.TransientMetadata)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	d.Set("transient_metadata", transientMetadata)
+
+	enabled := true
+	if v, ok := roleData.TransientMetadata["enabled"].(bool); ok {
+		enabled = v
+	}
+	d.Set("enabled", enabled)
+
+	if !enabled {
+		return diag.Diagnostics{{
+			Severity: diag.Warning,
+			Summary:  fmt.Sprintf("Role '%s' is disabled", name),
+			Detail:   "Elasticsearch disabled the role, usually because it references privileges that are unknown to the cluster, such as privileges of a disabled feature or of a missing license.",
+		}}
+	}
+
 	return nil
 }
 
-func resourceElasticstackAuthRoleUpdate(d *schema.ResourceData, meta interface{}) error {
-	return resourceElasticstackAuthRoleCreate(d, meta)
+func resourceElasticstackAuthRoleUpdate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	return resourceElasticstackAuthRoleCreate(ctx, d, meta)
 }
 
-func resourceElasticstackAuthRoleDelete(d *schema.ResourceData, meta interface{}) error {
-	es := meta.(apiClient).es
+func resourceElasticstackAuthRoleDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	es, err := meta.(*apiClient).elasticsearch(d)
+	if err != nil {
+		return diag.FromErr(err)
+	}
 
-	name := d.Get("name").(string)
+	name := d.Id()
 	req := esapi.SecurityDeleteRoleRequest{
 		Name: name,
 	}
 
-	res, err := req.Do(context.Background(), es)
+	res, err := req.Do(ctx, es)
 	if err != nil {
-		return err
+		return diag.FromErr(err)
 	}
 	defer res.Body.Close()
 
-	if res.StatusCode != 200 {
-		return fmt.Errorf("%s", res)
+	if res.StatusCode != 200 && res.StatusCode != 404 {
+		return elasticsearchError(res, "Unable to delete role")
 	}
 
 	return nil
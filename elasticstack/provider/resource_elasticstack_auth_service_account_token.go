@@ -0,0 +1,196 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+var serviceAccountTokenNameRegex = regexp.MustCompile(`^[a-zA-Z0-9-][a-zA-Z0-9_-]{0,255}$`)
+
+func resourceElasticstackAuthServiceAccountToken() *schema.Resource {
+	return &schema.Resource{
+		Description: "Manages a token of a service account, such as `elastic/fleet-server` or `elastic/kibana`. The value of the token is only known when it is created, tokens cannot be imported.",
+
+		CreateContext: resourceElasticstackAuthServiceAccountTokenCreate,
+		ReadContext:   resourceElasticstackAuthServiceAccountTokenRead,
+		UpdateContext: resourceElasticstackAuthServiceAccountTokenUpdate,
+		DeleteContext: resourceElasticstackAuthServiceAccountTokenDelete,
+		CustomizeDiff: requireElasticsearchVersion("7.13"),
+		Timeouts: &schema.ResourceTimeout{
+			Default: schema.DefaultTimeout(5 * time.Minute),
+		},
+
+		Schema: map[string]*schema.Schema{
+			"elasticsearch_connection": elasticsearchConnectionResourceSchema(),
+			"namespace": {
+				Type:     schema.TypeString,
+				Required: true,
+				ForceNew: true,
+			},
+			"service": {
+				Type:     schema.TypeString,
+				Required: true,
+				ForceNew: true,
+			},
+			"name": {
+				Type:         schema.TypeString,
+				Required:     true,
+				ForceNew:     true,
+				ValidateFunc: validateServiceAccountTokenName,
+			},
+			"value": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Sensitive:   true,
+				Description: "Secret value of the token, used as a bearer token.",
+			},
+		},
+	}
+}
+
+func validateServiceAccountTokenName(i interface{}, k string) ([]string, []error) {
+	v, ok := i.(string)
+	if !ok {
+		return nil, []error{fmt.Errorf("expected type of %s to be string", k)}
+	}
+	if !serviceAccountTokenNameRegex.MatchString(v) {
+		return nil, []error{fmt.Errorf("%q must be 1 to 256 letters, digits, '-' or '_' and cannot start with '_', got '%s'", k, v)}
+	}
+	return nil, nil
+}
+
+func serviceAccountTokenPath(namespace, service, name string) string {
+	path := fmt.Sprintf("/_security/service/%s/%s/credential", url.PathEscape(namespace), url.PathEscape(service))
+	if name != "" {
+		path += "/token/" + url.PathEscape(name)
+	}
+	return path
+}
+
+func parseServiceAccountTokenId(id string) (namespace, service, name string, err error) {
+	parts := strings.Split(id, "/")
+	if len(parts) != 3 {
+		return "", "", "", fmt.Errorf("unexpected format of ID (%s), expected namespace/service/name", id)
+	}
+	return parts[0], parts[1], parts[2], nil
+}
+
+func resourceElasticstackAuthServiceAccountTokenCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	es, err := meta.(*apiClient).elasticsearch(d)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	namespace := d.Get("namespace").(string)
+	service := d.Get("service").(string)
+	name := d.Get("name").(string)
+
+	res, err := performRequest(ctx, es, "POST", serviceAccountTokenPath(namespace, service, name))
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != 200 {
+		return elasticsearchError(res, "Unable to create service account token")
+	}
+
+	var tokenData struct {
+		Token struct {
+			Name  string `json:"name"`
+			Value string `json:"value"`
+		} `json:"token"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&tokenData); err != nil {
+		return diag.FromErr(err)
+	}
+
+	d.SetId(fmt.Sprintf("%s/%s/%s", namespace, service, name))
+	d.Set("value", tokenData.Token.Value)
+	return resourceElasticstackAuthServiceAccountTokenRead(ctx, d, meta)
+}
+
+func resourceElasticstackAuthServiceAccountTokenRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	es, err := meta.(*apiClient).elasticsearch(d)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	namespace, service, name, err := parseServiceAccountTokenId(d.Id())
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	res, err := performRequest(ctx, es, "GET", serviceAccountTokenPath(namespace, service, ""))
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == 404 {
+		log.Printf("[WARN] service account '%s/%s' not found, removing token from state", namespace, service)
+		d.SetId("")
+		return nil
+	}
+	if res.StatusCode != 200 {
+		return elasticsearchError(res, "Unable to get service account credentials")
+	}
+
+	var credentials struct {
+		Tokens map[string]interface{} `json:"tokens"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&credentials); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if _, ok := credentials.Tokens[name]; !ok {
+		log.Printf("[WARN] service account token '%s' not found, removing from state", d.Id())
+		d.SetId("")
+		return nil
+	}
+
+	d.Set("namespace", namespace)
+	d.Set("service", service)
+	d.Set("name", name)
+
+	return nil
+}
+
+func resourceElasticstackAuthServiceAccountTokenUpdate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	// only the credentials of elasticsearch_connection can change in place, all other
+	// attributes force a new token
+	return resourceElasticstackAuthServiceAccountTokenRead(ctx, d, meta)
+}
+
+func resourceElasticstackAuthServiceAccountTokenDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	es, err := meta.(*apiClient).elasticsearch(d)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	namespace, service, name, err := parseServiceAccountTokenId(d.Id())
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	res, err := performRequest(ctx, es, "DELETE", serviceAccountTokenPath(namespace, service, name))
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != 200 && res.StatusCode != 404 {
+		return elasticsearchError(res, "Unable to delete service account token")
+	}
+
+	return nil
+}
@@ -0,0 +1,45 @@
+package provider
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseServiceAccountTokenId(t *testing.T) {
+	namespace, service, name, err := parseServiceAccountTokenId("elastic/fleet-server/token1")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if namespace != "elastic" || service != "fleet-server" || name != "token1" {
+		t.Fatalf("unexpected ID parts: %s, %s, %s", namespace, service, name)
+	}
+
+	for _, id := range []string{"elastic/fleet-server", "elastic/fleet-server/token1/extra", "token1"} {
+		if _, _, _, err := parseServiceAccountTokenId(id); err == nil {
+			t.Errorf("%s: expected an error", id)
+		}
+	}
+}
+
+func TestValidateServiceAccountTokenName(t *testing.T) {
+	cases := map[string]bool{
+		"token1":                 true,
+		"fleet-server_01":        true,
+		"-token":                 true,
+		"_token":                 false,
+		"":                       false,
+		"token/1":                false,
+		"token 1":                false,
+		strings.Repeat("a", 256): true,
+		strings.Repeat("a", 257): false,
+	}
+	for name, valid := range cases {
+		_, errs := validateServiceAccountTokenName(name, "name")
+		if valid && len(errs) > 0 {
+			t.Errorf("%q: unexpected errors: %v", name, errs)
+		}
+		if !valid && len(errs) == 0 {
+			t.Errorf("%q: expected an error", name)
+		}
+	}
+}
@@ -5,25 +5,36 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"log"
+	"strings"
+	"time"
 
+	"github.com/elastic/go-elasticsearch/v7"
 	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 )
 
 func resourceElasticstackAuthUser() *schema.Resource {
 	return &schema.Resource{
-		Create: resourceElasticstackAuthUserCreate,
-		Read:   resourceElasticstackAuthUserRead,
-		Update: resourceElasticstackAuthUserUpdate,
-		Delete: resourceElasticstackAuthUserDelete,
+		CreateContext: resourceElasticstackAuthUserCreate,
+		ReadContext:   resourceElasticstackAuthUserRead,
+		UpdateContext: resourceElasticstackAuthUserUpdate,
+		DeleteContext: resourceElasticstackAuthUserDelete,
 		Importer: &schema.ResourceImporter{
 			StateContext: schema.ImportStatePassthroughContext,
 		},
+		CustomizeDiff: validateUserPasswordHashAlgorithm,
+		Timeouts: &schema.ResourceTimeout{
+			Default: schema.DefaultTimeout(5 * time.Minute),
+		},
 
 		Schema: map[string]*schema.Schema{
+			"elasticsearch_connection": elasticsearchConnectionResourceSchema(),
 			"username": {
 				Type:     schema.TypeString,
 				Required: true,
+				ForceNew: true,
 			},
 			"full_name": {
 				Type:     schema.TypeString,
@@ -34,18 +45,36 @@ func resourceElasticstackAuthUser() *schema.Resource {
 				Optional: true,
 			},
 			"metadata": {
-				Type:     schema.TypeString,
-				Optional: true,
+				Type:             schema.TypeString,
+				Optional:         true,
+				Description:      "Arbitrary metadata of the user, as a JSON object.",
+				ValidateFunc:     validateJSONObject,
+				DiffSuppressFunc: suppressEquivalentJSONDiffs,
+			},
+			"enabled": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     true,
+				Description: "Whether the user is enabled, disabled users cannot authenticate.",
 			},
 			"password": {
-				Type:      schema.TypeString,
-				Optional:  true,
-				Sensitive: true,
+				Type:          schema.TypeString,
+				Optional:      true,
+				Sensitive:     true,
+				ConflictsWith: []string{"password_hash"},
 			},
 			"password_hash": {
-				Type:      schema.TypeString,
-				Optional:  true,
-				Sensitive: true,
+				Type:          schema.TypeString,
+				Optional:      true,
+				Sensitive:     true,
+				Description:   "Hash of the password, which must use the hashing algorithm configured in the cluster (`$2a$` for bcrypt, `{PBKDF2}` for PBKDF2).",
+				ConflictsWith: []string{"password"},
+				ValidateFunc:  validatePasswordHashFormat,
+			},
+			"password_version": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "Arbitrary value that triggers a password change when modified, even if `password` or `password_hash` did not change.",
 			},
 			"roles": {
 				Type:     schema.TypeList,
@@ -59,12 +88,14 @@ func resourceElasticstackAuthUser() *schema.Resource {
 }
 
 type esapiUserData struct {
-	Username     string   `json:"username"`
-	FullName     string   `json:"full_name"`
-	Email        string   `json:"email"`
-	Password     string   `json:"password,omitempty"`
-	PasswordHash string   `json:"password_hash,omitempty"`
-	Roles        []string `json:"roles"`
+	Username     string                 `json:"username"`
+	FullName     string                 `json:"full_name"`
+	Email        string                 `json:"email"`
+	Metadata     map[string]interface{} `json:"metadata"`
+	Enabled      bool                   `json:"enabled"`
+	Password     string                 `json:"password,omitempty"`
+	PasswordHash string                 `json:"password_hash,omitempty"`
+	Roles        []string               `json:"roles"`
 }
 
 func parseUserResourceData(d *schema.ResourceData) (esapiUserData, error) {
@@ -72,11 +103,18 @@ func parseUserResourceData(d *schema.ResourceData) (esapiUserData, error) {
 		Username:     d.Get("username").(string),
 		FullName:     d.Get("full_name").(string),
 		Email:        d.Get("email").(string),
+		Enabled:      d.Get("enabled").(bool),
 		Password:     d.Get("password").(string),
 		PasswordHash: d.Get("password_hash").(string),
 		Roles:        expandStringList(d.Get("roles").([]interface{})),
 	}
 
+	metadata, err := expandJSONObject(d.Get("metadata").(string))
+	if err != nil {
+		return userData, fmt.Errorf("unable to parse 'metadata': %w", err)
+	}
+	userData.Metadata = metadata
+
 	if userData.Password == "" && userData.PasswordHash == "" {
 		return userData, fmt.Errorf("must specify either 'password' or 'password_hash'")
 	}
@@ -87,17 +125,29 @@ func parseUserResourceData(d *schema.ResourceData) (esapiUserData, error) {
 	return userData, nil
 }
 
-func resourceElasticstackAuthUserCreate(d *schema.ResourceData, meta interface{}) error {
-	es := meta.(apiClient).es
+func resourceElasticstackAuthUserCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	es, err := meta.(*apiClient).elasticsearch(d)
+	if err != nil {
+		return diag.FromErr(err)
+	}
 
 	userData, err := parseUserResourceData(d)
 	if err != nil {
-		return err
+		return diag.FromErr(err)
 	}
 
+	if diags := putUser(ctx, es, userData); diags.HasError() {
+		return diags
+	}
+
+	d.SetId(userData.Username)
+	return resourceElasticstackAuthUserRead(ctx, d, meta)
+}
+
+func putUser(ctx context.Context, es *elasticsearch.Client, userData esapiUserData) diag.Diagnostics {
 	bodyJson, err := json.Marshal(userData)
 	if err != nil {
-		return err
+		return diag.FromErr(err)
 	}
 
 	req := esapi.SecurityPutUserRequest{
@@ -105,49 +155,126 @@ func resourceElasticstackAuthUserCreate(d *schema.ResourceData, meta interface{}
 		Body:     bytes.NewReader(bodyJson),
 	}
 
-	res, err := req.Do(context.Background(), es)
+	res, err := req.Do(ctx, es)
 	if err != nil {
-		return err
+		return diag.FromErr(err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != 200 {
+		return elasticsearchError(res, "Unable to put user")
+	}
+
+	return nil
+}
+
+func changeUserPassword(ctx context.Context, es *elasticsearch.Client, username string, password string, passwordHash string) diag.Diagnostics {
+	body := map[string]string{}
+	if passwordHash != "" {
+		body["password_hash"] = passwordHash
+	} else {
+		body["password"] = password
+	}
+
+	bodyJson, err := json.Marshal(body)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	req := esapi.SecurityChangePasswordRequest{
+		Username: username,
+		Body:     bytes.NewReader(bodyJson),
+	}
+
+	res, err := req.Do(ctx, es)
+	if err != nil {
+		return diag.FromErr(err)
 	}
 	defer res.Body.Close()
 
 	if res.StatusCode != 200 {
-		return fmt.Errorf("%s", res)
+		return elasticsearchError(res, "Unable to change password of user")
 	}
 
-	return resourceElasticstackAuthUserRead(d, meta)
+	return nil
 }
 
-func resourceElasticstackAuthUserRead(d *schema.ResourceData, meta interface{}) error {
-	es := meta.(apiClient).es
+func setUserEnabled(ctx context.Context, es *elasticsearch.Client, username string, enabled bool) diag.Diagnostics {
+	var res *esapi.Response
+	var err error
+	if enabled {
+		req := esapi.SecurityEnableUserRequest{
+			Username: username,
+		}
+		res, err = req.Do(ctx, es)
+	} else {
+		req := esapi.SecurityDisableUserRequest{
+			Username: username,
+		}
+		res, err = req.Do(ctx, es)
+	}
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	defer res.Body.Close()
 
-	username := d.Get("username").(string)
+	if res.StatusCode != 200 {
+		return elasticsearchError(res, "Unable to change enabled state of user")
+	}
+
+	return nil
+}
+
+func resourceElasticstackAuthUserRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	es, err := meta.(*apiClient).elasticsearch(d)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	username := d.Id()
 
 	req := esapi.SecurityGetUserRequest{
 		Username: []string{username},
 	}
 
-	res, err := req.Do(context.Background(), es)
+	res, err := req.Do(ctx, es)
 	if err != nil {
-		return err
+		return diag.FromErr(err)
 	}
 	defer res.Body.Close()
 
+	if res.StatusCode == 404 {
+		log.Printf("[WARN] user '%s' not found, removing from state", username)
+		d.SetId("")
+		return nil
+	}
 	if res.StatusCode != 200 {
-		return fmt.Errorf("%s", res)
+		return elasticsearchError(res, "Unable to get user")
 	}
 
 	var userDataList map[string]esapiUserData
 	err = json.NewDecoder(res.Body).Decode(&userDataList)
 	if err != nil {
-		return err
+		return diag.FromErr(err)
+	}
+
+	userData, ok := userDataList[username]
+	if !ok {
+		log.Printf("[WARN] user '%s' not found, removing from state", username)
+		d.SetId("")
+		return nil
 	}
 
-	d.SetId(username)
-	userData := userDataList[username]
 	d.Set("username", userData.Username)
 	d.Set("full_name", userData.FullName)
 	d.Set("email", userData.Email)
+	d.Set("enabled", userData.Enabled)
+
+	metadata, err := flattenJSONObject(userData.Metadata)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	d.Set("metadata", metadata)
 
 	var roleList []interface{}
 	for _, i := range userData.Roles {
@@ -158,27 +285,184 @@ func resourceElasticstackAuthUserRead(d *schema.ResourceData, meta interface{})
 	return nil
 }
 
-func resourceElasticstackAuthUserUpdate(d *schema.ResourceData, meta interface{}) error {
-	return resourceElasticstackAuthUserCreate(d, meta)
+func resourceElasticstackAuthUserUpdate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	es, err := meta.(*apiClient).elasticsearch(d)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	userData, err := parseUserResourceData(d)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	// passwords are only changed through the change password API on update
+	password, passwordHash := userData.Password, userData.PasswordHash
+	userData.Password, userData.PasswordHash = "", ""
+
+	if diags := putUser(ctx, es, userData); diags.HasError() {
+		return diags
+	}
+
+	if d.HasChanges("password", "password_hash", "password_version") {
+		if diags := changeUserPassword(ctx, es, userData.Username, password, passwordHash); diags.HasError() {
+			return diags
+		}
+	}
+
+	if d.HasChange("enabled") {
+		if diags := setUserEnabled(ctx, es, userData.Username, userData.Enabled); diags.HasError() {
+			return diags
+		}
+	}
+
+	return resourceElasticstackAuthUserRead(ctx, d, meta)
 }
 
-func resourceElasticstackAuthUserDelete(d *schema.ResourceData, meta interface{}) error {
-	es := meta.(*apiClient).es
+func resourceElasticstackAuthUserDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	es, err := meta.(*apiClient).elasticsearch(d)
+	if err != nil {
+		return diag.FromErr(err)
+	}
 
-	username := d.Get("username").(string)
+	username := d.Id()
 	req := esapi.SecurityDeleteUserRequest{
 		Username: username,
 	}
 
-	res, err := req.Do(context.Background(), es)
+	res, err := req.Do(ctx, es)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != 200 && res.StatusCode != 404 {
+		return elasticsearchError(res, "Unable to delete user")
+	}
+
+	return nil
+}
+
+var passwordHashPrefixes = map[string][]string{
+	"bcrypt":         {"$2a$", "$2b$", "$2y$"},
+	"pbkdf2":         {"{PBKDF2}"},
+	"pbkdf2_stretch": {"{PBKDF2_STRETCH}"},
+}
+
+// passwordHashFamily returns the family of a hashing algorithm setting, such as "bcrypt"
+// for "bcrypt12" or "pbkdf2" for "pbkdf2_50000".
+func passwordHashFamily(algorithm string) string {
+	algorithm = strings.ToLower(algorithm)
+	switch {
+	case strings.HasPrefix(algorithm, "bcrypt"):
+		return "bcrypt"
+	case strings.HasPrefix(algorithm, "pbkdf2_stretch"):
+		return "pbkdf2_stretch"
+	case strings.HasPrefix(algorithm, "pbkdf2"):
+		return "pbkdf2"
+	}
+	return algorithm
+}
+
+func validatePasswordHashFormat(i interface{}, k string) ([]string, []error) {
+	v, ok := i.(string)
+	if !ok {
+		return nil, []error{fmt.Errorf("expected type of %s to be string", k)}
+	}
+	for _, prefixes := range passwordHashPrefixes {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(v, prefix) {
+				return nil, nil
+			}
+		}
+	}
+	return nil, []error{fmt.Errorf("%q must be a bcrypt (`$2a$`) or PBKDF2 (`{PBKDF2}`) hash", k)}
+}
+
+// validateUserPasswordHashAlgorithm checks that a password hash uses the hashing algorithm
+// configured in the cluster, which Elasticsearch would otherwise reject at apply time.
+func validateUserPasswordHashAlgorithm(ctx context.Context, d *schema.ResourceDiff, meta interface{}) error {
+	passwordHash := d.Get("password_hash").(string)
+	if passwordHash == "" || !d.HasChange("password_hash") {
+		return nil
+	}
+
+	es, err := meta.(*apiClient).elasticsearch(d)
 	if err != nil {
 		return err
 	}
+
+	algorithm, err := fetchPasswordHashingAlgorithm(ctx, es)
+	if err != nil {
+		return err
+	}
+	if algorithm == "" {
+		log.Printf("[WARN] not allowed to read the node settings, skipping the check of the password hashing algorithm")
+		return nil
+	}
+
+	if !passwordHashMatchesAlgorithm(passwordHash, algorithm) {
+		return fmt.Errorf("'password_hash' does not match the password hashing algorithm of the cluster (%s)", algorithm)
+	}
+	return nil
+}
+
+// passwordHashMatchesAlgorithm returns whether a password hash was created with the given
+// hashing algorithm setting.
+func passwordHashMatchesAlgorithm(passwordHash string, algorithm string) bool {
+	for _, prefix := range passwordHashPrefixes[passwordHashFamily(algorithm)] {
+		if strings.HasPrefix(passwordHash, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+type esapiNodesSettings struct {
+	Nodes map[string]struct {
+		Settings struct {
+			Xpack struct {
+				Security struct {
+					Authc struct {
+						PasswordHashing struct {
+							Algorithm string `json:"algorithm"`
+						} `json:"password_hashing"`
+					} `json:"authc"`
+				} `json:"security"`
+			} `json:"xpack"`
+		} `json:"settings"`
+	} `json:"nodes"`
+}
+
+// fetchPasswordHashingAlgorithm returns the password hashing algorithm of the cluster, or an
+// empty string when the credentials lack the `monitor` privilege needed to read it.
+func fetchPasswordHashingAlgorithm(ctx context.Context, es *elasticsearch.Client) (string, error) {
+	res, err := es.Nodes.Info(
+		es.Nodes.Info.WithContext(ctx),
+		es.Nodes.Info.WithMetric("settings"),
+		es.Nodes.Info.WithFilterPath("nodes.*.settings.xpack.security.authc.password_hashing.algorithm"),
+	)
+	if err != nil {
+		return "", err
+	}
 	defer res.Body.Close()
 
+	if res.StatusCode == 403 {
+		return "", nil
+	}
 	if res.StatusCode != 200 {
-		return fmt.Errorf("%s", res)
+		return "", diagnosticsError(elasticsearchError(res, "Unable to get node settings"))
 	}
 
-	return nil
+	var nodes esapiNodesSettings
+	if err := json.NewDecoder(res.Body).Decode(&nodes); err != nil {
+		return "", err
+	}
+	for _, n := range nodes.Nodes {
+		if algorithm := n.Settings.Xpack.Security.Authc.PasswordHashing.Algorithm; algorithm != "" {
+			return algorithm, nil
+		}
+	}
+
+	return "bcrypt", nil
 }
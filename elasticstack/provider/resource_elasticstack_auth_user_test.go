@@ -3,6 +3,8 @@ package provider
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/elastic/go-elasticsearch/v7/esapi"
@@ -17,9 +19,18 @@ func TestAccElasticstackAuthUserBasic(t *testing.T) {
 		CheckDestroy: testAccCheckElasticstackAuthUserDestroy,
 		Steps: []resource.TestStep{
 			{
-				Config: testAccCheckElasticstackAuthUserConfigBasic(),
+				Config: testAccCheckElasticstackAuthUserConfigBasic(true),
 				Check: resource.ComposeTestCheckFunc(
 					testAccCheckElasticstackAuthUserExists("elasticstack_auth_user.test"),
+					resource.TestCheckResourceAttr("elasticstack_auth_user.test", "metadata", `{"owner":"test","team":"platform"}`),
+					resource.TestCheckResourceAttr("elasticstack_auth_user.test", "enabled", "true"),
+				),
+			},
+			{
+				Config: testAccCheckElasticstackAuthUserConfigBasic(false),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckElasticstackAuthUserExists("elasticstack_auth_user.test"),
+					resource.TestCheckResourceAttr("elasticstack_auth_user.test", "enabled", "false"),
 				),
 			},
 		},
@@ -54,7 +65,7 @@ func testAccCheckElasticstackAuthUserDestroy(s *terraform.State) error {
 	return nil
 }
 
-func testAccCheckElasticstackAuthUserConfigBasic() string {
+func testAccCheckElasticstackAuthUserConfigBasic(enabled bool) string {
 	username := "test1"
 	fullName := "test tester"
 	email := "test@example.com"
@@ -66,8 +77,13 @@ func testAccCheckElasticstackAuthUserConfigBasic() string {
 		email = "%s"
 		password = "%s"
 		roles = []
+		enabled = %t
+		metadata = jsonencode({
+			team  = "platform"
+			owner = "test"
+		})
 	}
-	`, username, fullName, email, password)
+	`, username, fullName, email, password, enabled)
 }
 
 func testAccCheckElasticstackAuthUserExists(n string) resource.TestCheckFunc {
@@ -85,3 +101,100 @@ func testAccCheckElasticstackAuthUserExists(n string) resource.TestCheckFunc {
 		return nil
 	}
 }
+
+func TestPasswordHashFamily(t *testing.T) {
+	cases := map[string]string{
+		"bcrypt":               "bcrypt",
+		"bcrypt12":             "bcrypt",
+		"BCRYPT":               "bcrypt",
+		"pbkdf2":               "pbkdf2",
+		"pbkdf2_50000":         "pbkdf2",
+		"pbkdf2_stretch":       "pbkdf2_stretch",
+		"pbkdf2_stretch_10000": "pbkdf2_stretch",
+		"ssha256":              "ssha256",
+	}
+	for algorithm, expected := range cases {
+		if family := passwordHashFamily(algorithm); family != expected {
+			t.Errorf("%s: expected family %s, got %s", algorithm, expected, family)
+		}
+	}
+}
+
+func TestValidatePasswordHashFormat(t *testing.T) {
+	cases := map[string]bool{
+		"$2a$10$abcdefghijklmnopqrstuv":   true,
+		"$2b$12$abcdefghijklmnopqrstuv":   true,
+		"$2y$10$abcdefghijklmnopqrstuv":   true,
+		"{PBKDF2}10000$salt$hash":         true,
+		"{PBKDF2_STRETCH}10000$salt$hash": true,
+		"plaintext":                       false,
+		"$1$md5hash":                      false,
+		"{SSHA256}hash":                   false,
+	}
+	for hash, valid := range cases {
+		_, errs := validatePasswordHashFormat(hash, "password_hash")
+		if valid && len(errs) > 0 {
+			t.Errorf("%s: unexpected errors: %v", hash, errs)
+		}
+		if !valid && len(errs) == 0 {
+			t.Errorf("%s: expected an error", hash)
+		}
+	}
+}
+
+func TestPasswordHashMatchesAlgorithm(t *testing.T) {
+	cases := []struct {
+		hash      string
+		algorithm string
+		matches   bool
+	}{
+		{"$2a$12$abcdefghijklmnopqrstuv", "bcrypt12", true},
+		{"$2y$10$abcdefghijklmnopqrstuv", "bcrypt", true},
+		{"$2a$12$abcdefghijklmnopqrstuv", "pbkdf2", false},
+		{"{PBKDF2}10000$salt$hash", "pbkdf2_50000", true},
+		{"{PBKDF2}10000$salt$hash", "pbkdf2_stretch_10000", false},
+		{"{PBKDF2_STRETCH}10000$salt$hash", "pbkdf2_stretch_10000", true},
+		{"{PBKDF2_STRETCH}10000$salt$hash", "pbkdf2", false},
+		{"{PBKDF2}10000$salt$hash", "bcrypt", false},
+	}
+	for _, c := range cases {
+		if matches := passwordHashMatchesAlgorithm(c.hash, c.algorithm); matches != c.matches {
+			t.Errorf("%s against %s: expected %t, got %t", c.hash, c.algorithm, c.matches, matches)
+		}
+	}
+}
+
+func TestFetchPasswordHashingAlgorithm(t *testing.T) {
+	status := 200
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		if status == 200 {
+			fmt.Fprint(w, `{"nodes": {"node1": {"settings": {"xpack": {"security": {"authc": {"password_hashing": {"algorithm": "pbkdf2_stretch"}}}}}}}}`)
+		} else {
+			fmt.Fprint(w, `{"error": {"type": "security_exception", "reason": "action [cluster:monitor/nodes/info] is unauthorized"}, "status": 403}`)
+		}
+	}))
+	defer server.Close()
+
+	es, err := newElasticsearchClient(connectionConfig{urls: []string{server.URL}, apiKey: "key"})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	algorithm, err := fetchPasswordHashingAlgorithm(context.Background(), es)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if algorithm != "pbkdf2_stretch" {
+		t.Fatalf("unexpected algorithm: %s", algorithm)
+	}
+
+	status = 403
+	algorithm, err = fetchPasswordHashingAlgorithm(context.Background(), es)
+	if err != nil {
+		t.Fatalf("expected the check to be skipped without the monitor privilege, got: %s", err)
+	}
+	if algorithm != "" {
+		t.Fatalf("unexpected algorithm: %s", algorithm)
+	}
+}
@@ -1,22 +1,33 @@
 package provider
 
 import (
-	"fmt"
+	"context"
 	"log"
 	"strings"
+	"time"
 
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 )
 
 func resourceElasticstackFleetAgentPolicy() *schema.Resource {
 	return &schema.Resource{
-		Create: resourceElasticstackFleetAgentCreate,
-		Read:   resourceElasticstackFleetAgentRead,
-		Update: resourceElasticstackFleetAgentUpdate,
-		Delete: resourceElasticstackFleetAgentDelete,
+		CreateContext: resourceElasticstackFleetAgentCreate,
+		ReadContext:   resourceElasticstackFleetAgentRead,
+		UpdateContext: resourceElasticstackFleetAgentUpdate,
+		DeleteContext: resourceElasticstackFleetAgentDelete,
 		Importer: &schema.ResourceImporter{
 			StateContext: schema.ImportStatePassthroughContext,
 		},
+		Timeouts: &schema.ResourceTimeout{
+			Create:  schema.DefaultTimeout(10 * time.Minute),
+			Update:  schema.DefaultTimeout(10 * time.Minute),
+			Default: schema.DefaultTimeout(5 * time.Minute),
+		},
+		CustomizeDiff: customizeDiffAll(
+			requireKibana,
+			requireKibanaVersion("7.10"),
+		),
 
 		Schema: map[string]*schema.Schema{
 			"name": {
@@ -84,6 +95,14 @@ type KibanaFleetPackagePolicy struct {
 	} `json:"package"`
 }
 
+type KibanaFleetPackages struct {
+	Response []struct {
+		Name    string `json:"name"`
+		Title   string `json:"title"`
+		Version string `json:"version"`
+	} `json:"response"`
+}
+
 type KibanaEnrollmentKeyList struct {
 	List []struct {
 		Id       string `json:"id"`
@@ -98,31 +117,34 @@ type KibanaEnrollmentKeyDetails struct {
 }
 
 // Warning! This function can create the policy but there is no support for updating it yet
-func resourceElasticstackFleetAgentCreate(d *schema.ResourceData, meta interface{}) error {
-	k := meta.(apiClient).k
+func resourceElasticstackFleetAgentCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	k, err := meta.(*apiClient).kibana(ctx)
+	if err != nil {
+		return diag.FromErr(err)
+	}
 
-	resp, err := k.R().
+	resp, err := k.R().SetContext(ctx).
 		SetHeader("Content-Type", "application/json").
 		SetBody(`{"forceRecreate": false}`).
 		Post("/api/fleet/agents/setup")
 
 	if err != nil {
-		return err
+		return diag.FromErr(err)
 	}
 	if resp.StatusCode() != 200 {
-		return fmt.Errorf("error in agent setup post: %s", resp.Body())
+		return diag.Errorf("error in agent setup post: %s", resp.Body())
 	}
 
 	var agentPolicies KibanaFleetAgentPolicies
-	resp, err = k.R().
+	resp, err = k.R().SetContext(ctx).
 		SetResult(&agentPolicies).
 		Get("/api/fleet/agent_policies")
 
 	if err != nil {
-		return err
+		return diag.FromErr(err)
 	}
 	if resp.StatusCode() != 200 {
-		return fmt.Errorf("error in agent policy get: %s", resp.Body())
+		return diag.Errorf("error in agent policy get: %s", resp.Body())
 	}
 
 	log.Printf("[INFO] agent policies %d, %s", resp.StatusCode(), resp.Body())
@@ -136,7 +158,30 @@ func resourceElasticstackFleetAgentCreate(d *schema.ResourceData, meta interface
 	}
 
 	if defaultId == "" {
-		return fmt.Errorf("could not find default agent policy")
+		return diag.Errorf("could not find default agent policy")
+	}
+
+	var packages KibanaFleetPackages
+	resp, err = k.R().SetContext(ctx).
+		SetResult(&packages).
+		Get("/api/fleet/epm/packages")
+
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	if resp.StatusCode() != 200 {
+		return diag.Errorf("error in package list get: %s", resp.Body())
+	}
+
+	var endpointVersion string
+	for _, p := range packages.Response {
+		if p.Name == "endpoint" {
+			endpointVersion = p.Version
+		}
+	}
+
+	if endpointVersion == "" {
+		return diag.Errorf("could not find endpoint package")
 	}
 
 	packagePolicy := KibanaFleetPackagePolicy{
@@ -148,38 +193,38 @@ func resourceElasticstackFleetAgentCreate(d *schema.ResourceData, meta interface
 	}
 	packagePolicy.Package.Name = "endpoint"
 	packagePolicy.Package.Title = "Endpoint Security"
-	packagePolicy.Package.Version = "0.18.0"
+	packagePolicy.Package.Version = endpointVersion
 
 	log.Printf("[INFO] package policy %v", packagePolicy)
 
-	resp, err = k.R().
+	resp, err = k.R().SetContext(ctx).
 		SetHeader("Content-Type", "application/json").
 		SetBody(packagePolicy).
 		Post("/api/fleet/package_policies")
 
 	if err != nil {
-		return err
+		return diag.FromErr(err)
 	}
 	if resp.StatusCode() != 200 {
 		if !strings.Contains(string(resp.Body()), "There is already a package with the same name on this agent policy") {
 			// purposely allow this error case for now to support easily re-creating the same integration
 			// this is a temporary hack
-			return fmt.Errorf("error in package policy post: %s", resp.Body())
+			return diag.Errorf("error in package policy post: %s", resp.Body())
 		}
 	}
 
 	log.Printf("[INFO] package policy response %d, %s", resp.StatusCode(), resp.Body())
 
 	var enrollmentKeyList KibanaEnrollmentKeyList
-	resp, err = k.R().
+	resp, err = k.R().SetContext(ctx).
 		SetResult(&enrollmentKeyList).
 		Get("/api/fleet/enrollment-api-keys")
 
 	if err != nil {
-		return err
+		return diag.FromErr(err)
 	}
 	if resp.StatusCode() != 200 {
-		return fmt.Errorf("error in enrollment key list get: %s", resp.Body())
+		return diag.Errorf("error in enrollment key list get: %s", resp.Body())
 	}
 
 	log.Printf("[INFO] enrollment key list %d, %s", resp.StatusCode(), resp.Body())
@@ -193,37 +238,37 @@ func resourceElasticstackFleetAgentCreate(d *schema.ResourceData, meta interface
 	}
 
 	if enrollmentId == "" {
-		return fmt.Errorf("could not find enrollment key for default policy")
+		return diag.Errorf("could not find enrollment key for default policy")
 	}
 
 	var enrollmentKeyDetails KibanaEnrollmentKeyDetails
-	resp, err = k.R().
+	resp, err = k.R().SetContext(ctx).
 		SetResult(&enrollmentKeyDetails).
 		Get("/api/fleet/enrollment-api-keys/" + enrollmentId)
 
 	if err != nil {
-		return err
+		return diag.FromErr(err)
 	}
 	if resp.StatusCode() != 200 {
-		return fmt.Errorf("error in enrollment key details get: %s", resp.Body())
+		return diag.Errorf("error in enrollment key details get: %s", resp.Body())
 	}
 	log.Printf("[INFO] enrollment key details %d, %s", resp.StatusCode(), resp.Body())
 	log.Printf("[INFO] parsed enrollment key details %v", enrollmentKeyDetails)
 
 	d.Set("enrollment_secret", enrollmentKeyDetails.Item.ApiKey)
 
-	return resourceElasticstackFleetAgentRead(d, meta)
+	return resourceElasticstackFleetAgentRead(ctx, d, meta)
 }
 
-func resourceElasticstackFleetAgentRead(d *schema.ResourceData, meta interface{}) error {
+func resourceElasticstackFleetAgentRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
 	d.SetId(d.Get("name").(string))
 	return nil
 }
 
-func resourceElasticstackFleetAgentUpdate(d *schema.ResourceData, meta interface{}) error {
-	return resourceElasticstackFleetAgentCreate(d, meta)
+func resourceElasticstackFleetAgentUpdate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	return resourceElasticstackFleetAgentCreate(ctx, d, meta)
 }
 
-func resourceElasticstackFleetAgentDelete(d *schema.ResourceData, meta interface{}) error {
-	return fmt.Errorf("delete is not supported")
+func resourceElasticstackFleetAgentDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	return diag.Errorf("delete is not supported")
 }
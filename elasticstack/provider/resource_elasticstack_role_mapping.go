@@ -5,42 +5,96 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 )
 
 func resourceElasticstackAuthRoleMapping() *schema.Resource {
 	return &schema.Resource{
-		Create: resourceElasticstackAuthRoleMappingCreate,
-		Read:   resourceElasticstackAuthRoleMappingRead,
-		Update: resourceElasticstackAuthRoleMappingUpdate,
-		Delete: resourceElasticstackAuthRoleMappingDelete,
+		CreateContext: resourceElasticstackAuthRoleMappingCreate,
+		ReadContext:   resourceElasticstackAuthRoleMappingRead,
+		UpdateContext: resourceElasticstackAuthRoleMappingUpdate,
+		DeleteContext: resourceElasticstackAuthRoleMappingDelete,
 		Importer: &schema.ResourceImporter{
 			StateContext: schema.ImportStatePassthroughContext,
 		},
+		Timeouts: &schema.ResourceTimeout{
+			Default: schema.DefaultTimeout(5 * time.Minute),
+		},
 
 		Schema: map[string]*schema.Schema{
+			"elasticsearch_connection": elasticsearchConnectionResourceSchema(),
 			"name": {
 				Type:     schema.TypeString,
 				Required: true,
+				ForceNew: true,
 			},
 			"roles": {
-				Type:     schema.TypeList,
-				Required: true,
+				Type:         schema.TypeList,
+				Optional:     true,
+				ExactlyOneOf: []string{"roles", "role_template"},
 				Elem: &schema.Schema{
 					Type: schema.TypeString,
 				},
 			},
+			"role_template": {
+				Type:         schema.TypeList,
+				Optional:     true,
+				Description:  "Mustache templates evaluated to determine the role names, such as `{{#tojson}}groups{{/tojson}}`.",
+				ExactlyOneOf: []string{"roles", "role_template"},
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"source": {
+							Type:        schema.TypeString,
+							Optional:    true,
+							Description: "Source of the mustache template. Exactly one of `source` or `id` must be set.",
+						},
+						"id": {
+							Type:        schema.TypeString,
+							Optional:    true,
+							Description: "Identifier of a stored mustache script. Exactly one of `source` or `id` must be set.",
+						},
+						"format": {
+							Type:         schema.TypeString,
+							Optional:     true,
+							Default:      "string",
+							Description:  "Format of the template result, `string` for a single role name or `json` for an array of role names.",
+							ValidateFunc: validateRoleTemplateFormat,
+						},
+					},
+				},
+			},
 			"enabled": {
 				Type:     schema.TypeBool,
 				Optional: true,
 				Default:  true,
 			},
+			"metadata": {
+				Type:             schema.TypeString,
+				Optional:         true,
+				Description:      "Arbitrary metadata of the role mapping as a JSON object, available to role templates as `{{metadata.<key>}}`.",
+				ValidateFunc:     validateJSONObject,
+				DiffSuppressFunc: suppressEquivalentJSONDiffs,
+			},
+			"rules": {
+				Type:             schema.TypeString,
+				Optional:         true,
+				Description:      "Rules of the role mapping as a JSON object, supporting nested `any`, `all` and `except` rules and any field value. Alternative to the `rule` block.",
+				ExactlyOneOf:     []string{"rule", "rules"},
+				ValidateFunc:     validateRoleMappingRules,
+				DiffSuppressFunc: suppressEquivalentJSONDiffs,
+			},
 			"rule": {
-				Type:     schema.TypeList,
-				Required: true,
-				MaxItems: 1,
+				Type:         schema.TypeList,
+				Optional:     true,
+				MaxItems:     1,
+				ExactlyOneOf: []string{"rule", "rules"},
 				Elem: &schema.Resource{
 					Schema: map[string]*schema.Schema{
 						"require_all": {
@@ -63,12 +117,14 @@ func resourceElasticstackAuthRoleMapping() *schema.Resource {
 										Required: true,
 									},
 									"type": {
-										Type:     schema.TypeString,
-										Required: true,
+										Type:         schema.TypeString,
+										Required:     true,
+										Description:  "Type of the value, one of `text`, `number`, `boolean` or `null`.",
+										ValidateFunc: validateFieldRuleType,
 									},
 									"value": {
 										Type:     schema.TypeString,
-										Required: true,
+										Optional: true,
 									},
 								},
 							},
@@ -87,11 +143,36 @@ type esapiRoleMappingRule struct {
 	Field  map[string]interface{}  `json:"field,omitempty"`
 }
 
+type esapiRoleMappingTemplateScript struct {
+	Source string `json:"source,omitempty"`
+	Id     string `json:"id,omitempty"`
+}
+
+type esapiRoleMappingTemplate struct {
+	// Elasticsearch returns the template script encoded as a JSON string
+	Template json.RawMessage `json:"template"`
+	Format   string          `json:"format,omitempty"`
+}
+
+func (t esapiRoleMappingTemplate) script() (esapiRoleMappingTemplateScript, error) {
+	var script esapiRoleMappingTemplateScript
+	raw := []byte(t.Template)
+
+	var encoded string
+	if err := json.Unmarshal(raw, &encoded); err == nil {
+		raw = []byte(encoded)
+	}
+	err := json.Unmarshal(raw, &script)
+	return script, err
+}
+
 type esapiRoleMappingData struct {
-	Name    string                `json:"-"`
-	Enabled bool                  `json:"enabled,omitempty"`
-	Roles   []string              `json:"roles,omitempty"`
-	Rules   *esapiRoleMappingRule `json:"rules,omitempty"`
+	Name          string                     `json:"-"`
+	Enabled       bool                       `json:"enabled,omitempty"`
+	Roles         []string                   `json:"roles,omitempty"`
+	RoleTemplates []esapiRoleMappingTemplate `json:"role_templates,omitempty"`
+	Rules         *esapiRoleMappingRule      `json:"rules,omitempty"`
+	Metadata      map[string]interface{}     `json:"metadata,omitempty"`
 }
 
 func parseRoleMappingData(d *schema.ResourceData) (esapiRoleMappingData, error) {
@@ -99,20 +180,53 @@ func parseRoleMappingData(d *schema.ResourceData) (esapiRoleMappingData, error)
 		Name:    d.Get("name").(string),
 		Enabled: d.Get("enabled").(bool),
 		Roles:   expandStringList(d.Get("roles").([]interface{})),
-		Rules: &esapiRoleMappingRule{
-			Field: map[string]interface{}{},
-		},
 	}
+
+	metadata, err := expandJSONObject(d.Get("metadata").(string))
+	if err != nil {
+		return role, fmt.Errorf("unable to parse 'metadata': %w", err)
+	}
+	if len(metadata) > 0 {
+		role.Metadata = metadata
+	}
+
+	for _, t := range d.Get("role_template").([]interface{}) {
+		tMap := t.(map[string]interface{})
+		script := esapiRoleMappingTemplateScript{
+			Source: tMap["source"].(string),
+			Id:     tMap["id"].(string),
+		}
+		if (script.Source == "") == (script.Id == "") {
+			return role, fmt.Errorf("exactly one of 'source' or 'id' must be set in 'role_template'")
+		}
+		scriptJson, err := json.Marshal(script)
+		if err != nil {
+			return role, err
+		}
+		role.RoleTemplates = append(role.RoleTemplates, esapiRoleMappingTemplate{
+			Template: scriptJson,
+			Format:   tMap["format"].(string),
+		})
+	}
+
+	if rulesJson := d.Get("rules").(string); rulesJson != "" {
+		rules, err := expandRoleMappingRules(rulesJson)
+		if err != nil {
+			return role, fmt.Errorf("unable to parse 'rules': %w", err)
+		}
+		role.Rules = rules
+		return role, nil
+	}
+
 	rule := d.Get("rule").([]interface{})[0].(map[string]interface{})
 	fields := rule["field"].([]interface{})
 	fieldRuleList := []*esapiRoleMappingRule{}
 
 	for _, f := range fields {
 		fMap := f.(map[string]interface{})
-		t := fMap["type"].(string)
-		v := fMap["value"].(string)
-		if t != "text" {
-			return role, fmt.Errorf("field rule type '%s' is not supported", t)
+		v, err := expandFieldRuleValue(fMap["type"].(string), fMap["value"].(string))
+		if err != nil {
+			return role, fmt.Errorf("invalid value of field rule '%s': %w", fMap["name"].(string), err)
 		}
 		fieldRuleList = append(fieldRuleList, &esapiRoleMappingRule{
 			Field: map[string]interface{}{
@@ -136,17 +250,140 @@ func parseRoleMappingData(d *schema.ResourceData) (esapiRoleMappingData, error)
 	return role, nil
 }
 
-func resourceElasticstackAuthRoleMappingCreate(d *schema.ResourceData, meta interface{}) error {
-	es := meta.(apiClient).es
+// expandRoleMappingRules decodes rules from JSON, rejecting unknown keys that would otherwise
+// be silently dropped, such as a misspelled `all`.
+func expandRoleMappingRules(rulesJson string) (*esapiRoleMappingRule, error) {
+	rules := &esapiRoleMappingRule{}
+	dec := json.NewDecoder(strings.NewReader(rulesJson))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(rules); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+func validateRoleMappingRules(i interface{}, k string) ([]string, []error) {
+	v, ok := i.(string)
+	if !ok {
+		return nil, []error{fmt.Errorf("expected type of %s to be string", k)}
+	}
+	if _, errs := validateJSONObject(v, k); len(errs) > 0 {
+		return nil, errs
+	}
+	if _, err := expandRoleMappingRules(v); err != nil {
+		return nil, []error{fmt.Errorf("%q contains an invalid rule: %s", k, err)}
+	}
+	return nil, nil
+}
+
+func validateRoleTemplateFormat(i interface{}, k string) ([]string, []error) {
+	v, ok := i.(string)
+	if !ok {
+		return nil, []error{fmt.Errorf("expected type of %s to be string", k)}
+	}
+	if v != "string" && v != "json" {
+		return nil, []error{fmt.Errorf("%q must be either 'string' or 'json', got '%s'", k, v)}
+	}
+	return nil, nil
+}
+
+func validateFieldRuleType(i interface{}, k string) ([]string, []error) {
+	v, ok := i.(string)
+	if !ok {
+		return nil, []error{fmt.Errorf("expected type of %s to be string", k)}
+	}
+	switch v {
+	case "text", "number", "boolean", "null":
+		return nil, nil
+	}
+	return nil, []error{fmt.Errorf("%q must be one of 'text', 'number', 'boolean' or 'null', got '%s'", k, v)}
+}
+
+func expandFieldRuleValue(t string, v string) (interface{}, error) {
+	switch t {
+	case "text":
+		return v, nil
+	case "number":
+		return strconv.ParseFloat(v, 64)
+	case "boolean":
+		return strconv.ParseBool(v)
+	case "null":
+		return nil, nil
+	}
+	return nil, fmt.Errorf("field rule type '%s' is not supported", t)
+}
+
+// flattenFieldRuleValue returns the type and value of a field rule, or false if the value
+// cannot be expressed in a `field` block.
+func flattenFieldRuleValue(v interface{}) (string, string, bool) {
+	switch value := v.(type) {
+	case string:
+		return "text", value, true
+	case float64:
+		return "number", strconv.FormatFloat(value, 'f', -1, 64), true
+	case bool:
+		return "boolean", strconv.FormatBool(value), true
+	case nil:
+		return "null", "", true
+	}
+	return "", "", false
+}
+
+// flattenRoleMappingRuleBlock converts rules into a `rule` block, or returns false when the
+// rules use more than a single level of `all` or `any` field rules.
+func flattenRoleMappingRuleBlock(rules *esapiRoleMappingRule) (map[string]interface{}, bool) {
+	if rules == nil || rules.Field != nil || rules.Except != nil {
+		return nil, false
+	}
+
+	rule := map[string]interface{}{}
+	var rulesList []*esapiRoleMappingRule
+	if len(rules.All) > 0 && len(rules.Any) == 0 {
+		rule["require_all"] = true
+		rulesList = rules.All
+	} else if len(rules.Any) > 0 && len(rules.All) == 0 {
+		rule["require_any"] = true
+		rulesList = rules.Any
+	} else {
+		return nil, false
+	}
+
+	fieldList := []interface{}{}
+	for _, r := range rulesList {
+		if len(r.All) > 0 || len(r.Any) > 0 || r.Except != nil || len(r.Field) != 1 {
+			return nil, false
+		}
+		for k, v := range r.Field {
+			t, value, ok := flattenFieldRuleValue(v)
+			if !ok {
+				return nil, false
+			}
+			fieldList = append(fieldList, map[string]interface{}{
+				"name":  k,
+				"type":  t,
+				"value": value,
+			})
+		}
+	}
+	rule["field"] = fieldList
+
+	return rule, true
+}
+
+func resourceElasticstackAuthRoleMappingCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	es, err := meta.(*apiClient).elasticsearch(d)
+	if err != nil {
+		return diag.FromErr(err)
+	}
 
 	roleMappingData, err := parseRoleMappingData(d)
 	if err != nil {
-		return err
+		return diag.FromErr(err)
 	}
 
 	bodyJson, err := json.Marshal(roleMappingData)
 	if err != nil {
-		return err
+		return diag.FromErr(err)
 	}
 
 	req := esapi.SecurityPutRoleMappingRequest{
@@ -154,103 +391,130 @@ func resourceElasticstackAuthRoleMappingCreate(d *schema.ResourceData, meta inte
 		Body: bytes.NewReader(bodyJson),
 	}
 
-	res, err := req.Do(context.Background(), es)
+	res, err := req.Do(ctx, es)
 	if err != nil {
-		return err
+		return diag.FromErr(err)
 	}
 	defer res.Body.Close()
 
 	if res.StatusCode != 200 {
-		return fmt.Errorf("%s", res)
+		return elasticsearchError(res, "Unable to create role mapping")
 	}
 
-	return resourceElasticstackAuthRoleMappingRead(d, meta)
+	d.SetId(roleMappingData.Name)
+	return resourceElasticstackAuthRoleMappingRead(ctx, d, meta)
 }
 
-func resourceElasticstackAuthRoleMappingRead(d *schema.ResourceData, meta interface{}) error {
-	es := meta.(apiClient).es
+func resourceElasticstackAuthRoleMappingRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	es, err := meta.(*apiClient).elasticsearch(d)
+	if err != nil {
+		return diag.FromErr(err)
+	}
 
-	name := d.Get("name").(string)
+	name := d.Id()
 
 	req := esapi.SecurityGetRoleMappingRequest{
 		Name: []string{name},
 	}
 
-	res, err := req.Do(context.Background(), es)
+	res, err := req.Do(ctx, es)
 	if err != nil {
-		return err
+		return diag.FromErr(err)
 	}
 	defer res.Body.Close()
 
+	if res.StatusCode == 404 {
+		log.Printf("[WARN] role mapping '%s' not found, removing from state", name)
+		d.SetId("")
+		return nil
+	}
 	if res.StatusCode != 200 {
-		return fmt.Errorf("%s", res)
+		return elasticsearchError(res, "Unable to get role mapping")
 	}
 
 	var roleMappingDataList map[string]esapiRoleMappingData
 	err = json.NewDecoder(res.Body).Decode(&roleMappingDataList)
 	if err != nil {
-		return err
+		return diag.FromErr(err)
+	}
+
+	roleMappingData, ok := roleMappingDataList[name]
+	if !ok {
+		log.Printf("[WARN] role mapping '%s' not found, removing from state", name)
+		d.SetId("")
+		return nil
 	}
 
-	d.SetId(name)
-	roleMappingData := roleMappingDataList[name]
 	d.Set("name", name)
 	d.Set("roles", collapseStringList(roleMappingData.Roles))
-	d.Set("enabled", roleMappingData.Enabled)
 
-	if roleMappingData.Rules.Field != nil {
-		return fmt.Errorf("role mapping resources with top-level fields are not supported")
+	roleTemplates := make([]interface{}, 0)
+	for _, t := range roleMappingData.RoleTemplates {
+		script, err := t.script()
+		if err != nil {
+			return diag.Errorf("unable to parse role template of role mapping '%s': %s", name, err)
+		}
+		format := t.Format
+		if format == "" {
+			format = "string"
+		}
+		roleTemplates = append(roleTemplates, map[string]interface{}{
+			"source": script.Source,
+			"id":     script.Id,
+			"format": format,
+		})
 	}
-	rules := map[string]interface{}{}
-	var rulesList []*esapiRoleMappingRule
-	if len(roleMappingData.Rules.All) > 0 {
-		rules["require_all"] = true
-		rulesList = roleMappingData.Rules.All
-	} else if len(roleMappingData.Rules.Any) > 0 {
-		rules["require_any"] = true
-		rulesList = roleMappingData.Rules.Any
-	} else {
-		return fmt.Errorf("role mapping resource defined neither 'All' nor 'Any' rule array")
+	d.Set("role_template", roleTemplates)
+
+	metadata, err := flattenJSONObject(roleMappingData.Metadata)
+	if err != nil {
+		return diag.FromErr(err)
 	}
+	d.Set("metadata", metadata)
+	d.Set("enabled", roleMappingData.Enabled)
 
-	fieldList := []interface{}{}
-	for _, r := range rulesList {
-		field := map[string]interface{}{
-			"type": "text",
-		}
-		for k := range r.Field {
-			field["name"] = k
-			field["value"] = r.Field[k]
-			break
+	// rules are only kept as a block if the block is used in the state and can express them
+	if len(d.Get("rule").([]interface{})) > 0 {
+		if rule, ok := flattenRoleMappingRuleBlock(roleMappingData.Rules); ok {
+			d.Set("rule", []interface{}{rule})
+			d.Set("rules", "")
+			return nil
 		}
-		fieldList = append(fieldList, field)
 	}
-	rules["field"] = fieldList
-	d.Set("rule", []interface{}{rules})
+
+	rulesJson, err := json.Marshal(roleMappingData.Rules)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	d.Set("rules", string(rulesJson))
+	d.Set("rule", nil)
 
 	return nil
 }
 
-func resourceElasticstackAuthRoleMappingUpdate(d *schema.ResourceData, meta interface{}) error {
-	return resourceElasticstackAuthRoleMappingCreate(d, meta)
+func resourceElasticstackAuthRoleMappingUpdate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	return resourceElasticstackAuthRoleMappingCreate(ctx, d, meta)
 }
 
-func resourceElasticstackAuthRoleMappingDelete(d *schema.ResourceData, meta interface{}) error {
-	es := meta.(apiClient).es
+func resourceElasticstackAuthRoleMappingDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	es, err := meta.(*apiClient).elasticsearch(d)
+	if err != nil {
+		return diag.FromErr(err)
+	}
 
-	name := d.Get("name").(string)
+	name := d.Id()
 	req := esapi.SecurityDeleteRoleMappingRequest{
 		Name: name,
 	}
 
-	res, err := req.Do(context.Background(), es)
+	res, err := req.Do(ctx, es)
 	if err != nil {
-		return err
+		return diag.FromErr(err)
 	}
 	defer res.Body.Close()
 
-	if res.StatusCode != 200 {
-		return fmt.Errorf("%s", res)
+	if res.StatusCode != 200 && res.StatusCode != 404 {
+		return elasticsearchError(res, "Unable to delete role mapping")
 	}
 
 	return nil
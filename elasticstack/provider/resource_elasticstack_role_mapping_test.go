@@ -0,0 +1,105 @@
+package provider
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestFlattenRoleMappingRuleBlock(t *testing.T) {
+	var rules esapiRoleMappingRule
+	if err := json.Unmarshal([]byte(`{"all": [{"field": {"realm.name": "saml1"}}, {"field": {"metadata.level": 3}}, {"field": {"metadata.admin": true}}]}`), &rules); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	rule, ok := flattenRoleMappingRuleBlock(&rules)
+	if !ok {
+		t.Fatal("expected rules to be expressible as a block")
+	}
+	if rule["require_all"] != true {
+		t.Fatalf("expected require_all to be set: %v", rule)
+	}
+	fields := rule["field"].([]interface{})
+	expected := []map[string]interface{}{
+		{"name": "realm.name", "type": "text", "value": "saml1"},
+		{"name": "metadata.level", "type": "number", "value": "3"},
+		{"name": "metadata.admin", "type": "boolean", "value": "true"},
+	}
+	for i, e := range expected {
+		f := fields[i].(map[string]interface{})
+		for k, v := range e {
+			if f[k] != v {
+				t.Fatalf("unexpected field %d: %v", i, f)
+			}
+		}
+		value, err := expandFieldRuleValue(f["type"].(string), f["value"].(string))
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if value != rules.All[i].Field[f["name"].(string)] {
+			t.Fatalf("value of field %d does not round trip: %v", i, value)
+		}
+	}
+
+	nested := []string{
+		`{"any": [{"all": [{"field": {"username": "a"}}]}]}`,
+		`{"all": [{"field": {"groups": ["a", "b"]}}]}`,
+		`{"all": [{"field": {"username": "a"}}], "except": {"field": {"username": "b"}}}`,
+		`{"field": {"username": "*"}}`,
+	}
+	for _, n := range nested {
+		var rules esapiRoleMappingRule
+		if err := json.Unmarshal([]byte(n), &rules); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if _, ok := flattenRoleMappingRuleBlock(&rules); ok {
+			t.Fatalf("expected %s not to be expressible as a block", n)
+		}
+	}
+}
+
+func TestRoleMappingTemplateScript(t *testing.T) {
+	var mapping esapiRoleMappingData
+	body := `{"enabled": true, "role_templates": [
+		{"template": "{\"source\":\"{{#tojson}}groups{{/tojson}}\"}", "format": "json"},
+		{"template": {"id": "my-script"}, "format": "string"}
+	]}`
+	if err := json.Unmarshal([]byte(body), &mapping); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	script, err := mapping.RoleTemplates[0].script()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if script.Source != "{{#tojson}}groups{{/tojson}}" {
+		t.Fatalf("unexpected source: %s", script.Source)
+	}
+
+	script, err = mapping.RoleTemplates[1].script()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if script.Id != "my-script" {
+		t.Fatalf("unexpected id: %s", script.Id)
+	}
+}
+
+func TestExpandRoleMappingRules(t *testing.T) {
+	rules, err := expandRoleMappingRules(`{"all": [{"field": {"username": "*"}}, {"except": {"field": {"groups": "admins"}}}]}`)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(rules.All) != 2 || rules.All[1].Except == nil {
+		t.Fatalf("unexpected rules: %+v", rules)
+	}
+
+	_, err = expandRoleMappingRules(`{"alll": [{"field": {"username": "*"}}]}`)
+	if err == nil || !strings.Contains(err.Error(), `"alll"`) {
+		t.Fatalf("expected an error reporting the unknown key, got %v", err)
+	}
+
+	if _, errs := validateRoleMappingRules(`{"any": [{"feild": {"username": "*"}}]}`, "rules"); len(errs) == 0 {
+		t.Fatal("expected a validation error for a nested unknown key")
+	}
+}
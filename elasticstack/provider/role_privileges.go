@@ -0,0 +1,208 @@
+package provider
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// rolePrivilegesSchema returns the privilege attributes of a role descriptor, shared by
+// roles and the role descriptors of API keys.
+func rolePrivilegesSchema() map[string]*schema.Schema {
+	return map[string]*schema.Schema{
+		"cluster_privileges": {
+			Type:     schema.TypeList,
+			Optional: true,
+			Elem: &schema.Schema{
+				Type: schema.TypeString,
+			},
+		},
+		"run_as_privileges": {
+			Type:     schema.TypeList,
+			Optional: true,
+			Elem: &schema.Schema{
+				Type: schema.TypeString,
+			},
+		},
+		"index_privilege": {
+			Type:     schema.TypeList,
+			Optional: true,
+			Elem: &schema.Resource{
+				Schema: map[string]*schema.Schema{
+					"indices": {
+						Type:     schema.TypeList,
+						Required: true,
+						Elem: &schema.Schema{
+							Type: schema.TypeString,
+						},
+					},
+					"privileges": {
+						Type:     schema.TypeList,
+						Required: true,
+						Elem: &schema.Schema{
+							Type: schema.TypeString,
+						},
+					},
+					"granted_fields": {
+						Type:     schema.TypeList,
+						Optional: true,
+						Elem: &schema.Schema{
+							Type: schema.TypeString,
+						},
+					},
+					"denied_fields": {
+						Type:     schema.TypeList,
+						Optional: true,
+						Elem: &schema.Schema{
+							Type: schema.TypeString,
+						},
+					},
+					"query": {
+						Type:             schema.TypeString,
+						Optional:         true,
+						Description:      "Document level security query, as a JSON document. Templated queries use the `{\"template\": {\"source\": ...}}` form.",
+						ValidateFunc:     validateJSON,
+						DiffSuppressFunc: suppressEquivalentJSONDiffs,
+					},
+					"allow_restricted_indices": {
+						Type:     schema.TypeBool,
+						Optional: true,
+						Default:  false,
+					},
+				},
+			},
+		},
+		"application_privilege": {
+			Type:        schema.TypeList,
+			Optional:    true,
+			Description: "Privileges of custom applications. Privileges of Kibana are managed with `kibana_privilege`.",
+			Elem: &schema.Resource{
+				Schema: map[string]*schema.Schema{
+					"application": {
+						Type:         schema.TypeString,
+						Required:     true,
+						ValidateFunc: validateCustomApplication,
+					},
+					"privileges": {
+						Type:     schema.TypeList,
+						Required: true,
+						Elem: &schema.Schema{
+							Type: schema.TypeString,
+						},
+					},
+					"resources": {
+						Type:     schema.TypeList,
+						Required: true,
+						Elem: &schema.Schema{
+							Type: schema.TypeString,
+						},
+					},
+				},
+			},
+		},
+		"global_privileges": {
+			Type:             schema.TypeString,
+			Optional:         true,
+			Description:      "Global privileges of the role as a JSON object, for example `{\"application\": {\"manage\": {\"applications\": [\"*\"]}}}`.",
+			ValidateFunc:     validateJSONObject,
+			DiffSuppressFunc: suppressEquivalentJSONDiffs,
+		},
+		"kibana_privilege": kibanaPrivilegeSchema(),
+	}
+}
+
+// validateCustomApplication rejects the Kibana application, whose privileges are read back as
+// `kibana_privilege` blocks and would never converge in `application_privilege`.
+func validateCustomApplication(i interface{}, k string) ([]string, []error) {
+	v, ok := i.(string)
+	if !ok {
+		return nil, []error{fmt.Errorf("expected type of %s to be string", k)}
+	}
+	if v == kibanaApplication {
+		return nil, []error{fmt.Errorf("%q cannot be '%s', use a `kibana_privilege` block to grant Kibana privileges", k, kibanaApplication)}
+	}
+	return nil, nil
+}
+
+type esapiRoleDataIndex struct {
+	Names         []string `json:"names"`
+	Privileges    []string `json:"privileges"`
+	FieldSecurity struct {
+		Grant  []string `json:"grant"`
+		Except []string `json:"except"`
+	} `json:"field_security,omitempty"`
+	Query                  string `json:"query,omitempty"`
+	AllowRestrictedIndices bool   `json:"allow_restricted_indices"`
+}
+
+type esapiRoleDataApplication struct {
+	Application string   `json:"application"`
+	Privileges  []string `json:"privileges"`
+	Resources   []string `json:"resources"`
+}
+
+type esapiRoleData struct {
+	Name         string                     `json:"-"`
+	RunAs        []string                   `json:"run_as,omitempty"`
+	Cluster      []string                   `json:"cluster,omitempty"`
+	Global       map[string]interface{}     `json:"global,omitempty"`
+	Indices      []esapiRoleDataIndex       `json:"indices,omitempty"`
+	Applications []esapiRoleDataApplication `json:"applications,omitempty"`
+	Metadata     map[string]interface{}     `json:"metadata,omitempty"`
+
+	// only returned by Elasticsearch
+	TransientMetadata map[string]interface{} `json:"transient_metadata,omitempty"`
+}
+
+// expandRolePrivileges builds the privileges of a role descriptor, reading the attributes of
+// rolePrivilegesSchema through get.
+func expandRolePrivileges(get func(string) interface{}) (esapiRoleData, error) {
+	role := esapiRoleData{
+		RunAs:   expandStringList(get("run_as_privileges").([]interface{})),
+		Cluster: expandStringList(get("cluster_privileges").([]interface{})),
+	}
+	indexPrivileges := get("index_privilege").([]interface{})
+	if len(indexPrivileges) > 0 {
+		role.Indices = []esapiRoleDataIndex{}
+	}
+	for _, p := range indexPrivileges {
+		privilege := p.(map[string]interface{})
+		privilegeStruct := esapiRoleDataIndex{
+			Names:                  expandStringList(privilege["indices"].([]interface{})),
+			Privileges:             expandStringList(privilege["privileges"].([]interface{})),
+			Query:                  privilege["query"].(string),
+			AllowRestrictedIndices: privilege["allow_restricted_indices"].(bool),
+		}
+		privilegeStruct.FieldSecurity.Grant = expandStringList(privilege["granted_fields"].([]interface{}))
+		privilegeStruct.FieldSecurity.Except = expandStringList(privilege["denied_fields"].([]interface{}))
+		role.Indices = append(role.Indices, privilegeStruct)
+	}
+	global, err := expandJSONObject(get("global_privileges").(string))
+	if err != nil {
+		return role, fmt.Errorf("unable to parse 'global_privileges': %w", err)
+	}
+	if len(global) > 0 {
+		role.Global = global
+	}
+	applicationPrivileges := get("application_privilege").([]interface{})
+	kibanaPrivileges := get("kibana_privilege").([]interface{})
+	if len(applicationPrivileges) > 0 || len(kibanaPrivileges) > 0 {
+		role.Applications = []esapiRoleDataApplication{}
+	}
+	for _, p := range applicationPrivileges {
+		privilege := p.(map[string]interface{})
+		role.Applications = append(role.Applications, esapiRoleDataApplication{
+			Application: privilege["application"].(string),
+			Privileges:  expandStringList(privilege["privileges"].([]interface{})),
+			Resources:   expandStringList(privilege["resources"].([]interface{})),
+		})
+	}
+	for _, p := range kibanaPrivileges {
+		privilegeStruct, err := expandKibanaPrivilege(p.(map[string]interface{}))
+		if err != nil {
+			return role, err
+		}
+		role.Applications = append(role.Applications, privilegeStruct)
+	}
+	return role, nil
+}
@@ -1,5 +1,12 @@
 package provider
 
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
 func expandStringList(configured []interface{}) []string {
 	vs := make([]string, 0, len(configured))
 	for _, v := range configured {
@@ -11,6 +18,16 @@ func expandStringList(configured []interface{}) []string {
 	return vs
 }
 
+func expandIntList(configured []interface{}) []int {
+	vs := make([]int, 0, len(configured))
+	for _, v := range configured {
+		if val, ok := v.(int); ok {
+			vs = append(vs, val)
+		}
+	}
+	return vs
+}
+
 func collapseStringList(list []string) []interface{} {
 	var collapsed []interface{}
 	for _, i := range list {
@@ -18,3 +35,106 @@ func collapseStringList(list []string) []interface{} {
 	}
 	return collapsed
 }
+
+// normalizeJSON re-encodes a JSON document so that documents only differing in key order
+// or whitespace have the same representation.
+func normalizeJSON(s string) (string, error) {
+	if s == "" {
+		return "", nil
+	}
+	var v interface{}
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		return "", err
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func validateJSON(i interface{}, k string) ([]string, []error) {
+	v, ok := i.(string)
+	if !ok {
+		return nil, []error{fmt.Errorf("expected type of %s to be string", k)}
+	}
+	if _, err := normalizeJSON(v); err != nil {
+		return nil, []error{fmt.Errorf("%q contains invalid JSON: %s", k, err)}
+	}
+	return nil, nil
+}
+
+func validateJSONObject(i interface{}, k string) ([]string, []error) {
+	v, ok := i.(string)
+	if !ok {
+		return nil, []error{fmt.Errorf("expected type of %s to be string", k)}
+	}
+	if v == "" {
+		return nil, nil
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal([]byte(v), &m); err != nil {
+		return nil, []error{fmt.Errorf("%q must be a JSON object: %s", k, err)}
+	}
+	return nil, nil
+}
+
+func suppressEquivalentJSONDiffs(k, old, new string, d *schema.ResourceData) bool {
+	oldJSON, err := normalizeJSON(old)
+	if err != nil {
+		return false
+	}
+	newJSON, err := normalizeJSON(new)
+	if err != nil {
+		return false
+	}
+	// empty objects are not sent and read back as an empty string
+	if oldJSON == "{}" {
+		oldJSON = ""
+	}
+	if newJSON == "{}" {
+		newJSON = ""
+	}
+	return oldJSON == newJSON
+}
+
+// expandJSONObject decodes an optional JSON object attribute, returning an empty object when
+// the attribute is not set.
+func expandJSONObject(s string) (map[string]interface{}, error) {
+	m := map[string]interface{}{}
+	if s == "" {
+		return m, nil
+	}
+	if err := json.Unmarshal([]byte(s), &m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// flattenJSONObject encodes an object for a JSON attribute, using an empty string for an
+// empty object so that unset attributes do not show a diff.
+func flattenJSONObject(m map[string]interface{}) (string, error) {
+	if len(m) == 0 {
+		return "", nil
+	}
+	b, err := json.Marshal(m)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// forceNewSchema marks all the configurable attributes of a schema, including nested ones,
+// as forcing a new resource.
+func forceNewSchema(s map[string]*schema.Schema) map[string]*schema.Schema {
+	for _, v := range s {
+		if v.Computed && !v.Optional {
+			continue
+		}
+		v.ForceNew = true
+		if r, ok := v.Elem.(*schema.Resource); ok {
+			forceNewSchema(r.Schema)
+		}
+	}
+	return s
+}
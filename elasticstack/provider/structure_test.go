@@ -0,0 +1,76 @@
+package provider
+
+import (
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func TestSuppressEquivalentJSONDiffs(t *testing.T) {
+	cases := []struct {
+		old, new string
+		equal    bool
+	}{
+		{`{"a": 1, "b": [1, 2]}`, `{"b":[1,2],"a":1}`, true},
+		{`{"a": 1}`, `{"a": 2}`, false},
+		{`{"a": [1, 2]}`, `{"a": [2, 1]}`, false},
+		{``, ``, true},
+		{``, `{}`, true},
+		{`{ }`, ``, true},
+		{``, `{"a": 1}`, false},
+		{`{"a": 1}`, `not json`, false},
+	}
+
+	for _, c := range cases {
+		if suppressEquivalentJSONDiffs("metadata", c.old, c.new, nil) != c.equal {
+			t.Errorf("expected %q and %q equal to be %t", c.old, c.new, c.equal)
+		}
+	}
+}
+
+func TestForceNewSchema(t *testing.T) {
+	s := forceNewSchema(map[string]*schema.Schema{
+		"name": {
+			Type:     schema.TypeString,
+			Required: true,
+		},
+		"block": {
+			Type:     schema.TypeList,
+			Optional: true,
+			Elem: &schema.Resource{
+				Schema: map[string]*schema.Schema{
+					"nested": {
+						Type:     schema.TypeString,
+						Optional: true,
+					},
+					"nested_computed": {
+						Type:     schema.TypeString,
+						Computed: true,
+					},
+				},
+			},
+		},
+		"optional_computed": {
+			Type:     schema.TypeString,
+			Optional: true,
+			Computed: true,
+		},
+		"computed": {
+			Type:     schema.TypeString,
+			Computed: true,
+		},
+	})
+
+	for _, k := range []string{"name", "block", "optional_computed"} {
+		if !s[k].ForceNew {
+			t.Errorf("expected '%s' to force a new resource", k)
+		}
+	}
+	nested := s["block"].Elem.(*schema.Resource).Schema
+	if !nested["nested"].ForceNew {
+		t.Error("expected nested attributes to force a new resource")
+	}
+	if nested["nested_computed"].ForceNew || s["computed"].ForceNew {
+		t.Error("expected computed-only attributes to be left alone")
+	}
+}
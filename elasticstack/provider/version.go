@@ -0,0 +1,181 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/elastic/go-elasticsearch/v7"
+
+	"github.com/hashicorp/go-version"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+type esapiInfo struct {
+	Version struct {
+		Number string `json:"number"`
+	} `json:"version"`
+}
+
+type KibanaStatus struct {
+	Version struct {
+		Number string `json:"number"`
+	} `json:"version"`
+}
+
+// elasticsearchVersion returns the version of the cluster a resource talks to. The version
+// of each cluster is only fetched once.
+func (c *apiClient) elasticsearchVersion(ctx context.Context, d resourceData) (*version.Version, error) {
+	es, err := c.elasticsearch(d)
+	if err != nil {
+		return nil, err
+	}
+
+	c.esMu.Lock()
+	v, ok := c.esVersions[es]
+	c.esMu.Unlock()
+	if ok {
+		return v, nil
+	}
+
+	v, err = fetchElasticsearchVersion(ctx, es)
+	if err != nil {
+		return nil, err
+	}
+
+	c.esMu.Lock()
+	if c.esVersions == nil {
+		c.esVersions = map[*elasticsearch.Client]*version.Version{}
+	}
+	c.esVersions[es] = v
+	c.esMu.Unlock()
+	return v, nil
+}
+
+func fetchElasticsearchVersion(ctx context.Context, es *elasticsearch.Client) (*version.Version, error) {
+	res, err := es.Info(es.Info.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != 200 {
+		return nil, diagnosticsError(elasticsearchError(res, "Unable to get Elasticsearch cluster info"))
+	}
+
+	var info esapiInfo
+	if err := json.NewDecoder(res.Body).Decode(&info); err != nil {
+		return nil, err
+	}
+	return version.NewVersion(info.Version.Number)
+}
+
+// kibanaVersion returns the version of Kibana, fetched from its status API until a call
+// succeeds.
+func (c *apiClient) kibanaVersion(ctx context.Context) (*version.Version, error) {
+	c.kbVersionMu.Lock()
+	defer c.kbVersionMu.Unlock()
+
+	if c.kbVersion != nil {
+		return c.kbVersion, nil
+	}
+
+	k, err := c.kibana(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var status KibanaStatus
+	resp, err := k.R().
+		SetContext(ctx).
+		SetResult(&status).
+		Get("/api/status")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode() != 200 {
+		return nil, fmt.Errorf("unable to get Kibana status: %s", resp.Body())
+	}
+
+	v, err := version.NewVersion(status.Version.Number)
+	if err != nil {
+		return nil, err
+	}
+	c.kbVersion = v
+	return v, nil
+}
+
+// requireElasticsearchVersion fails the plan when the cluster is older than minVersion. When
+// attributes are given, the check only applies if one of them is set.
+func requireElasticsearchVersion(minVersion string, attributes ...string) schema.CustomizeDiffFunc {
+	min := version.Must(version.NewVersion(minVersion))
+	return func(ctx context.Context, d *schema.ResourceDiff, meta interface{}) error {
+		attribute, ok := firstAttributeSet(d, attributes)
+		if !ok {
+			return nil
+		}
+
+		v, err := meta.(*apiClient).elasticsearchVersion(ctx, d)
+		if err != nil {
+			return err
+		}
+		if v.Core().LessThan(min) {
+			return versionError(attribute, "Elasticsearch", minVersion, v)
+		}
+		return nil
+	}
+}
+
+// requireKibanaVersion fails the plan when Kibana is older than minVersion. When attributes
+// are given, the check only applies if one of them is set.
+func requireKibanaVersion(minVersion string, attributes ...string) schema.CustomizeDiffFunc {
+	min := version.Must(version.NewVersion(minVersion))
+	return func(ctx context.Context, d *schema.ResourceDiff, meta interface{}) error {
+		attribute, ok := firstAttributeSet(d, attributes)
+		if !ok {
+			return nil
+		}
+
+		v, err := meta.(*apiClient).kibanaVersion(ctx)
+		if err != nil {
+			return err
+		}
+		if v.Core().LessThan(min) {
+			return versionError(attribute, "Kibana", minVersion, v)
+		}
+		return nil
+	}
+}
+
+func firstAttributeSet(d *schema.ResourceDiff, attributes []string) (string, bool) {
+	if len(attributes) == 0 {
+		return "", true
+	}
+	for _, a := range attributes {
+		if _, ok := d.GetOk(a); ok {
+			return a, true
+		}
+	}
+	return "", false
+}
+
+func versionError(attribute string, service string, minVersion string, v *version.Version) error {
+	subject := "this resource"
+	if attribute != "" {
+		subject = fmt.Sprintf("'%s'", attribute)
+	}
+	return fmt.Errorf("%s requires %s >= %s, but the server runs %s", subject, service, minVersion, v)
+}
+
+// customizeDiffAll runs all the given functions, stopping at the first error.
+func customizeDiffAll(funcs ...schema.CustomizeDiffFunc) schema.CustomizeDiffFunc {
+	return func(ctx context.Context, d *schema.ResourceDiff, meta interface{}) error {
+		for _, f := range funcs {
+			if err := f(ctx, d, meta); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}